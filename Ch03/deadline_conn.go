@@ -0,0 +1,168 @@
+package ch03
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrLifetimeExceeded = errors.New("connection exceeded its maximum lifetime")
+
+// DeadlineConn is a net.Conn that manages its own deadlines. Rather than
+// callers pushing the deadline forward before every read, as TestDeadline
+// does, it sets the read or write deadline before each Read or Write, so the
+// connection times out only after being idle for ReadTimeout or WriteTimeout.
+// It also enforces a maximum lifetime no amount of activity extends, and it
+// records when it last read and wrote for idle reaping.
+//
+// Set the timeouts before using the connection.
+type DeadlineConn struct {
+	net.Conn
+
+	ReadTimeout  time.Duration // 0 means reads don't time out
+	WriteTimeout time.Duration // 0 means writes don't time out
+
+	// MaxLifetime, if positive, is how long after NewDeadlineConn reads and
+	// writes fail with ErrLifetimeExceeded.
+	MaxLifetime time.Duration
+
+	created time.Time
+
+	// UnixNano timestamps.
+	lastRead, lastWrite atomic.Int64
+
+	// The deadlines set by the caller, which still apply; zero means none.
+	// Each mutex serializes computing and setting the underlying deadline, so
+	// a Read or Write can't overwrite a deadline set concurrently to
+	// interrupt it.
+	rmu, wmu                    sync.Mutex
+	readDeadline, writeDeadline time.Time
+}
+
+// NewDeadlineConn wraps conn, starting its lifetime now.
+func NewDeadlineConn(conn net.Conn) *DeadlineConn {
+	now := time.Now()
+	c := &DeadlineConn{Conn: conn, created: now}
+	c.lastRead.Store(now.UnixNano())
+	c.lastWrite.Store(now.UnixNano())
+
+	return c
+}
+
+func (c *DeadlineConn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	err := c.Conn.SetReadDeadline(c.deadline(c.ReadTimeout, c.readDeadline))
+	c.rmu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.lastRead.Store(time.Now().UnixNano())
+	}
+
+	return n, c.lifetimeErr(err)
+}
+
+func (c *DeadlineConn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	err := c.Conn.SetWriteDeadline(c.deadline(c.WriteTimeout, c.writeDeadline))
+	c.wmu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.lastWrite.Store(time.Now().UnixNano())
+	}
+
+	return n, c.lifetimeErr(err)
+}
+
+// SetDeadline sets a read and write deadline that applies in addition to the
+// timeouts and lifetime. A zero value removes it.
+func (c *DeadlineConn) SetDeadline(t time.Time) error {
+	_ = c.SetReadDeadline(t)
+
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets a read deadline that applies in addition to the read
+// timeout and lifetime. A zero value removes it.
+func (c *DeadlineConn) SetReadDeadline(t time.Time) error {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	c.readDeadline = t
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets a write deadline that applies in addition to the write
+// timeout and lifetime. A zero value removes it.
+func (c *DeadlineConn) SetWriteDeadline(t time.Time) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.writeDeadline = t
+
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// Created returns when NewDeadlineConn wrapped the connection.
+func (c *DeadlineConn) Created() time.Time { return c.created }
+
+// LastRead returns when the connection last read data, or when it was created
+// if it hasn't.
+func (c *DeadlineConn) LastRead() time.Time { return time.Unix(0, c.lastRead.Load()) }
+
+// LastWrite returns when the connection last wrote data, or when it was
+// created if it hasn't.
+func (c *DeadlineConn) LastWrite() time.Time { return time.Unix(0, c.lastWrite.Load()) }
+
+// LastActivity returns the later of LastRead and LastWrite.
+func (c *DeadlineConn) LastActivity() time.Time {
+	return time.Unix(0, max(c.lastRead.Load(), c.lastWrite.Load()))
+}
+
+// deadline returns the earliest of now plus the timeout, the end of the
+// connection's lifetime, and the caller's deadline, ignoring those not set.
+func (c *DeadlineConn) deadline(timeout time.Duration, set time.Time) time.Time {
+	var d time.Time
+
+	earliest := func(t time.Time) {
+		if d.IsZero() || t.Before(d) {
+			d = t
+		}
+	}
+
+	if timeout > 0 {
+		earliest(time.Now().Add(timeout))
+	}
+
+	if c.MaxLifetime > 0 {
+		earliest(c.created.Add(c.MaxLifetime))
+	}
+
+	if !set.IsZero() {
+		earliest(set)
+	}
+
+	return d
+}
+
+// lifetimeErr returns ErrLifetimeExceeded in place of a timeout caused by the
+// end of the connection's lifetime.
+func (c *DeadlineConn) lifetimeErr(err error) error {
+	if c.MaxLifetime > 0 && errors.Is(err, os.ErrDeadlineExceeded) &&
+		time.Since(c.created) >= c.MaxLifetime {
+		return ErrLifetimeExceeded
+	}
+
+	return err
+}
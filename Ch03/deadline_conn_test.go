@@ -0,0 +1,191 @@
+package ch03
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// deadlineConns returns a DeadlineConn wrapping the server end of a TCP
+// connection, along with the client end.
+func deadlineConns(t *testing.T) (*DeadlineConn, net.Conn) {
+	t.Helper()
+
+	client, server := connPair(t)
+
+	return NewDeadlineConn(server), client
+}
+
+func TestDeadlineConnIdle(t *testing.T) {
+	conn, client := deadlineConns(t)
+	conn.ReadTimeout = 100 * time.Millisecond
+
+	// Activity more frequent than the read timeout keeps extending the
+	// deadline beyond its original 100ms.
+	go func() {
+		for i := 0; i < 5; i++ {
+			time.Sleep(40 * time.Millisecond)
+			_, _ = client.Write([]byte("1"))
+		}
+	}()
+
+	start := time.Now()
+	buf := make([]byte, 1)
+
+	for i := 0; i < 5; i++ {
+		_, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expected reads to span 200ms; actual %s", elapsed)
+	}
+
+	lastRead := conn.LastRead()
+	if time.Since(lastRead) > 50*time.Millisecond {
+		t.Errorf("expected a recent last read; actual %s", lastRead)
+	}
+
+	if !conn.LastWrite().Equal(conn.Created()) {
+		t.Errorf("expected the last write at creation; actual %s", conn.LastWrite())
+	}
+
+	// Once the client goes quiet, the next read times out.
+	_, err := conn.Read(buf)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected a timeout; actual %v", err)
+	}
+
+	if !conn.LastRead().Equal(lastRead) {
+		t.Error("expected a failed read to leave the last read unchanged")
+	}
+
+	// Writing updates the last activity.
+	_, err = conn.Write([]byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !conn.LastActivity().Equal(conn.LastWrite()) ||
+		!conn.LastWrite().After(lastRead) {
+		t.Errorf("expected the last activity to be the write; actual %s",
+			conn.LastActivity())
+	}
+}
+
+func TestDeadlineConnMaxLifetime(t *testing.T) {
+	conn, client := deadlineConns(t)
+	conn.ReadTimeout = time.Second
+	conn.MaxLifetime = 150 * time.Millisecond
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// The client never goes idle.
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+				_, _ = client.Write([]byte("1"))
+			}
+		}
+	}()
+
+	buf := make([]byte, 1)
+
+	var err error
+	for err == nil {
+		_, err = conn.Read(buf)
+	}
+
+	if !errors.Is(err, ErrLifetimeExceeded) {
+		t.Fatalf("expected ErrLifetimeExceeded; actual %v", err)
+	}
+
+	if age := time.Since(conn.Created()); age < conn.MaxLifetime ||
+		age > conn.MaxLifetime+time.Second/2 {
+		t.Errorf("expected the read to fail at 150ms; actual %s", age)
+	}
+
+	_, err = conn.Write([]byte("late"))
+	if !errors.Is(err, ErrLifetimeExceeded) {
+		t.Errorf("expected ErrLifetimeExceeded writing; actual %v", err)
+	}
+}
+
+func TestDeadlineConnSetReadDeadline(t *testing.T) {
+	conn, _ := deadlineConns(t)
+	conn.ReadTimeout = time.Minute
+
+	// An earlier deadline set by the caller still applies.
+	err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	_, err = conn.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected a timeout; actual %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the caller's deadline to apply; read took %s", elapsed)
+	}
+}
+
+// slowDeadlineConn holds a connection's read deadline back while it signals
+// entered, widening the window between a DeadlineConn's Read computing its
+// deadline and setting it.
+type slowDeadlineConn struct {
+	net.Conn
+	entered chan struct{}
+}
+
+func (c slowDeadlineConn) SetReadDeadline(t time.Time) error {
+	if time.Until(t) > time.Second {
+		c.entered <- struct{}{}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+func TestDeadlineConnInterruptRead(t *testing.T) {
+	_, server := connPair(t)
+
+	entered := make(chan struct{})
+	conn := NewDeadlineConn(slowDeadlineConn{Conn: server, entered: entered})
+	conn.ReadTimeout = time.Minute
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		errCh <- err
+	}()
+
+	// Setting the deadline to now while Read sets its own must still wake the
+	// read, rather than Read overwriting it.
+	<-entered
+
+	err := conn.SetReadDeadline(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-errCh:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected a timeout; actual %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the read interrupted")
+	}
+}
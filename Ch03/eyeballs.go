@@ -0,0 +1,264 @@
+package ch03
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const (
+	defaultResolutionDelay = 50 * time.Millisecond
+	defaultAttemptDelay    = 250 * time.Millisecond
+)
+
+// Resolver looks up the IP addresses of a host for the network "ip4" or "ip6".
+// *net.Resolver satisfies it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// HappyEyeballsDialer dials TCP connections using the Happy Eyeballs algorithm
+// described in RFC 8305. It resolves a host's IPv6 and IPv4 addresses
+// concurrently and races connection attempts to them, preferring IPv6 but
+// alternating between the families, starting a new attempt whenever the
+// previous one fails or AttemptDelay passes. The first connection wins, and
+// the remaining attempts are canceled.
+type HappyEyeballsDialer struct {
+	// Dialer makes each connection attempt.
+	Dialer net.Dialer
+
+	// Resolver looks up the host's addresses. nil means net.DefaultResolver.
+	Resolver Resolver
+
+	// ResolutionDelay is how long to wait for the IPv6 addresses if the IPv4
+	// addresses arrive first. 0 means 50ms.
+	ResolutionDelay time.Duration
+
+	// AttemptDelay is how long to wait for a connection attempt before
+	// starting the next one. 0 means 250ms.
+	AttemptDelay time.Duration
+}
+
+// Dial connects to address on the network "tcp", "tcp4" or "tcp6" and returns
+// the connection along with the address that won the race. If every attempt
+// fails, the error wraps each attempt's error.
+func (d *HappyEyeballsDialer) Dial(ctx context.Context, network,
+	address string) (net.Conn, netip.AddrPort, error) {
+	var want4, want6 bool
+
+	switch network {
+	case "tcp":
+		want4, want6 = true, true
+	case "tcp4":
+		want4 = true
+	case "tcp6":
+		want6 = true
+	default:
+		return nil, netip.AddrPort{}, net.UnknownNetworkError(network)
+	}
+
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, netip.AddrPort{}, err
+	}
+
+	port, err := net.LookupPort(network, service)
+	if err != nil {
+		return nil, netip.AddrPort{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := &race{
+		d:       d,
+		ctx:     ctx,
+		network: network,
+		address: address,
+		port:    uint16(port),
+		results: make(chan attempt),
+		ready:   !want6, // IPv4 attempts needn't wait for IPv6 addresses
+		prefer6: true,
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		r.add(ip.Unmap().Is6(), []netip.Addr{ip.Unmap()})
+		r.ready = true
+	} else {
+		r.lookup(host, want4, want6)
+	}
+
+	return r.run()
+}
+
+// attempt is the outcome of a connection attempt or lookup.
+type attempt struct {
+	conn  net.Conn
+	addr  netip.AddrPort
+	ipv6  bool         // for lookups, the family
+	addrs []netip.Addr // for lookups, the addresses found
+	err   error
+}
+
+// race holds the state of a single call to Dial.
+type race struct {
+	d       *HappyEyeballsDialer
+	ctx     context.Context
+	network string
+	address string
+	port    uint16
+
+	lookups chan attempt
+	pending int // lookups not yet answered
+	results chan attempt
+	running int // connection attempts not yet finished
+
+	ipv4, ipv6 []netip.Addr // addresses not yet attempted
+	prefer6    bool         // whether the next attempt should use IPv6
+	ready      bool         // whether attempts may start
+	errs       []error
+}
+
+func (r *race) lookup(host string, want4, want6 bool) {
+	resolver := r.d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	r.lookups = make(chan attempt, 2)
+
+	for _, family := range []struct {
+		want    bool
+		network string
+	}{{want6, "ip6"}, {want4, "ip4"}} {
+		if !family.want {
+			continue
+		}
+
+		r.pending++
+
+		go func() {
+			addrs, err := resolver.LookupNetIP(r.ctx, family.network, host)
+			r.lookups <- attempt{ipv6: family.network == "ip6", addrs: addrs, err: err}
+		}()
+	}
+}
+
+// add queues addresses from a lookup, skipping those of the wrong family.
+func (r *race) add(ipv6 bool, addrs []netip.Addr) {
+	for _, ip := range addrs {
+		ip = ip.Unmap()
+		switch {
+		case ip.Is6() && ipv6 && r.network != "tcp4":
+			r.ipv6 = append(r.ipv6, ip)
+		case ip.Is4() && !ipv6 && r.network != "tcp6":
+			r.ipv4 = append(r.ipv4, ip)
+		}
+	}
+}
+
+// next returns the next address to attempt, alternating between the families.
+func (r *race) next() (netip.Addr, bool) {
+	var ip netip.Addr
+
+	switch {
+	case len(r.ipv6) > 0 && (r.prefer6 || len(r.ipv4) == 0):
+		ip, r.ipv6 = r.ipv6[0], r.ipv6[1:]
+		r.prefer6 = false
+	case len(r.ipv4) > 0:
+		ip, r.ipv4 = r.ipv4[0], r.ipv4[1:]
+		r.prefer6 = true
+	default:
+		return ip, false
+	}
+
+	return ip, true
+}
+
+func (r *race) start(ip netip.Addr) {
+	r.running++
+	addr := netip.AddrPortFrom(ip, r.port)
+
+	go func() {
+		conn, err := r.d.Dialer.DialContext(r.ctx, r.network, addr.String())
+
+		select {
+		case r.results <- attempt{conn: conn, addr: addr, err: err}:
+		case <-r.ctx.Done(): // Dial returned; close the losing connection
+			if conn != nil {
+				_ = conn.Close()
+			}
+		}
+	}()
+}
+
+func (r *race) run() (net.Conn, netip.AddrPort, error) {
+	var (
+		nextAttempt <-chan time.Time // fires when the next attempt may start
+		resolution  <-chan time.Time // fires when the IPv6 addresses are late
+		canStart    = true
+	)
+
+	for {
+		if r.ready && canStart {
+			if ip, ok := r.next(); ok {
+				r.start(ip)
+				canStart = false
+				nextAttempt = time.After(delay(r.d.AttemptDelay, defaultAttemptDelay))
+			}
+		}
+
+		if r.pending == 0 && r.running == 0 && len(r.ipv4)+len(r.ipv6) == 0 {
+			if len(r.errs) == 0 {
+				r.errs = append(r.errs, errors.New("no addresses"))
+			}
+
+			return nil, netip.AddrPort{}, fmt.Errorf("dial %s %s: %w", r.network,
+				r.address, errors.Join(r.errs...))
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return nil, netip.AddrPort{}, errors.Join(append(r.errs, r.ctx.Err())...)
+		case a := <-r.lookups:
+			r.pending--
+			if a.err != nil {
+				r.errs = append(r.errs, a.err)
+			}
+			r.add(a.ipv6, a.addrs)
+
+			switch {
+			case a.ipv6 || r.pending == 0:
+				r.ready = true
+			case !r.ready && resolution == nil:
+				// The IPv4 addresses arrived first. Give the IPv6 addresses a
+				// moment before attempting IPv4.
+				resolution = time.After(delay(r.d.ResolutionDelay, defaultResolutionDelay))
+			}
+		case <-resolution:
+			r.ready = true
+		case <-nextAttempt:
+			canStart = true
+		case a := <-r.results:
+			r.running--
+			if a.err == nil {
+				return a.conn, a.addr, nil
+			}
+
+			r.errs = append(r.errs, a.err)
+			canStart = true // don't wait out the delay after a failure
+		}
+	}
+}
+
+// delay returns d, or def if d isn't positive.
+func delay(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+
+	return d
+}
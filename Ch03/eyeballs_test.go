@@ -0,0 +1,272 @@
+package ch03
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// stubResolver answers lookups for any host with its addresses after a delay.
+type stubResolver struct {
+	ipv4, ipv6     []netip.Addr
+	delay4, delay6 time.Duration
+	err4, err6     error
+}
+
+func (s stubResolver) LookupNetIP(ctx context.Context, network,
+	_ string) ([]netip.Addr, error) {
+	addrs, delay, err := s.ipv4, s.delay4, s.err4
+	if network == "ip6" {
+		addrs, delay, err = s.ipv6, s.delay6, s.err6
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(delay):
+	}
+
+	return addrs, err
+}
+
+var (
+	loopback4 = netip.MustParseAddr("127.0.0.1")
+	loopback6 = netip.MustParseAddr("::1")
+)
+
+// listenBoth listens on the same port of the IPv4 and IPv6 loopback addresses,
+// accepting and closing connections. It returns the port.
+func listenBoth(t *testing.T) string {
+	t.Helper()
+
+	for i := 0; i < 10; i++ {
+		l6, err := net.Listen("tcp", "[::1]:0")
+		if err != nil {
+			t.Skip("IPv6 loopback unavailable:", err)
+		}
+
+		_, port, _ := net.SplitHostPort(l6.Addr().String())
+
+		l4, err := net.Listen("tcp", "127.0.0.1:"+port)
+		if err != nil {
+			_ = l6.Close()
+			continue // the port is taken on IPv4; try another
+		}
+
+		for _, l := range []net.Listener{l4, l6} {
+			t.Cleanup(func() { _ = l.Close() })
+
+			go func() {
+				for {
+					conn, err := l.Accept()
+					if err != nil {
+						return
+					}
+					_ = conn.Close()
+				}
+			}()
+		}
+
+		return port
+	}
+
+	t.Fatal("failed to find a port free on both loopback addresses")
+
+	return ""
+}
+
+func TestHappyEyeballsPrefersIPv6(t *testing.T) {
+	port := listenBoth(t)
+
+	d := HappyEyeballsDialer{Resolver: stubResolver{
+		ipv4: []netip.Addr{loopback4},
+		ipv6: []netip.Addr{loopback6},
+	}}
+
+	conn, addr, err := d.Dial(context.Background(), "tcp", "localhost:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	if addr.Addr() != loopback6 {
+		t.Errorf("expected %s to win; actual %s", loopback6, addr)
+	}
+
+	// Restricting the network restricts the family.
+	conn, addr, err = d.Dial(context.Background(), "tcp4", "localhost:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	if addr.Addr() != loopback4 {
+		t.Errorf("expected %s to win; actual %s", loopback4, addr)
+	}
+}
+
+func TestHappyEyeballsStaggered(t *testing.T) {
+	port := listenBoth(t)
+
+	// Attempts to the IPv6 address hang until they're canceled.
+	canceled := make(chan struct{})
+
+	d := HappyEyeballsDialer{
+		Dialer: net.Dialer{
+			ControlContext: func(ctx context.Context, _, address string,
+				_ syscall.RawConn) error {
+				if netip.MustParseAddrPort(address).Addr() != loopback6 {
+					return nil
+				}
+
+				<-ctx.Done()
+				close(canceled)
+
+				return ctx.Err()
+			},
+		},
+		Resolver: stubResolver{
+			ipv4: []netip.Addr{loopback4},
+			ipv6: []netip.Addr{loopback6},
+		},
+		AttemptDelay: 100 * time.Millisecond,
+	}
+
+	start := time.Now()
+
+	conn, addr, err := d.Dial(context.Background(), "tcp", "localhost:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	if elapsed := time.Since(start); elapsed < d.AttemptDelay {
+		t.Errorf("IPv4 attempt started after %s; expected at least %s",
+			elapsed, d.AttemptDelay)
+	}
+
+	if addr.Addr() != loopback4 {
+		t.Errorf("expected %s to win; actual %s", loopback4, addr)
+	}
+
+	// The losing attempt is canceled once the winner returns.
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("expected the IPv6 attempt canceled")
+	}
+}
+
+func TestHappyEyeballsFallback(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// Nothing listens on the IPv6 address, so its refused attempt starts the
+	// IPv4 attempt without waiting out the attempt delay.
+	d := HappyEyeballsDialer{
+		Resolver: stubResolver{
+			ipv4: []netip.Addr{loopback4},
+			ipv6: []netip.Addr{loopback6},
+		},
+		AttemptDelay: time.Minute,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, addr, err := d.Dial(ctx, "tcp", "localhost:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	if addr.Addr() != loopback4 {
+		t.Errorf("expected %s to win; actual %s", loopback4, addr)
+	}
+}
+
+func TestHappyEyeballsResolutionDelay(t *testing.T) {
+	port := listenBoth(t)
+
+	for _, c := range []struct {
+		resolutionDelay time.Duration
+		expected        netip.Addr
+	}{
+		{time.Second, loopback6},      // the IPv6 addresses arrive in time
+		{time.Millisecond, loopback4}, // the IPv4 attempt starts first
+	} {
+		d := HappyEyeballsDialer{
+			Resolver: stubResolver{
+				ipv4:   []netip.Addr{loopback4},
+				ipv6:   []netip.Addr{loopback6},
+				delay6: 100 * time.Millisecond,
+			},
+			ResolutionDelay: c.resolutionDelay,
+		}
+
+		conn, addr, err := d.Dial(context.Background(), "tcp", "localhost:"+port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+
+		if addr.Addr() != c.expected {
+			t.Errorf("resolution delay %s: expected %s to win; actual %s",
+				c.resolutionDelay, c.expected, addr)
+		}
+	}
+}
+
+func TestHappyEyeballsAllFail(t *testing.T) {
+	// Find a port nothing listens on.
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	lookupErr := errors.New("no AAAA records")
+
+	d := HappyEyeballsDialer{Resolver: stubResolver{
+		ipv4: []netip.Addr{loopback4, netip.MustParseAddr("127.0.0.2")},
+		err6: lookupErr,
+	}}
+
+	_, _, err = d.Dial(context.Background(), "tcp",
+		net.JoinHostPort("localhost", strconv.Itoa(port)))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if !errors.Is(err, lookupErr) {
+		t.Errorf("expected the lookup error wrapped; actual %v", err)
+	}
+
+	// Each failed attempt's error is wrapped.
+	var (
+		opErr  *net.OpError
+		joined = errors.Unwrap(err).(interface{ Unwrap() []error })
+		addrs  []string
+	)
+
+	for _, e := range joined.Unwrap() {
+		if errors.As(e, &opErr) {
+			addrs = append(addrs, opErr.Addr.String())
+		}
+	}
+
+	if len(addrs) != 2 {
+		t.Errorf("expected 2 attempt errors; actual %v", err)
+	}
+}
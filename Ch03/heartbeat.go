@@ -0,0 +1,177 @@
+package ch03
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const defaultMaxMisses = 3
+
+var (
+	ErrMissedHeartbeats = errors.New("peer missed too many heartbeats")
+	ErrInvalidHeartbeat = errors.New("invalid heartbeat message")
+)
+
+// Heartbeat detects an unresponsive peer by exchanging pings and pongs with it
+// over a connection dedicated to heartbeats. Both peers run a Heartbeat: each
+// sends a ping on an interval and answers the other's pings with pongs.
+//
+// Each message is 8 bytes: "ping" or "pong" followed by a big-endian 32-bit
+// sequence number, which a pong echoes from its ping.
+type Heartbeat struct {
+	// MaxMisses is the number of consecutive pings the peer may leave
+	// unanswered before it's considered dead. A ping is missed if its pong
+	// hasn't arrived by the time the next ping is due. 0 means 3.
+	MaxMisses int
+
+	// OnRTT, if not nil, is called with the round-trip time of each ping.
+	OnRTT func(rtt time.Duration)
+
+	// OnFailure, if not nil, is called with the reason Run gives up on the
+	// peer. If it's nil, Run closes the connection instead.
+	OnFailure func(err error)
+}
+
+// Run exchanges heartbeats over conn until ctx is canceled, reading from conn
+// or writing to it fails, or the peer misses MaxMisses pings in a row. It uses
+// Pinger to send the pings, so the interval is adjustable through the reset
+// channel just as it is for Pinger.
+//
+// Run returns ctx's error if it's canceled, leaving conn open. Otherwise, it
+// calls OnFailure or closes conn and returns the reason.
+func (h *Heartbeat) Run(ctx context.Context, conn net.Conn,
+	reset <-chan time.Duration) error {
+	pingCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	hb := &heartbeat{Heartbeat: h, conn: conn, cancel: cancel}
+	done := make(chan struct{})
+
+	go func() {
+		hb.read()
+		close(done)
+	}()
+
+	Pinger(pingCtx, hb, reset)
+
+	// Interrupt the reader and restore the deadline once it returns.
+	_ = conn.SetReadDeadline(time.Now())
+	<-done
+	_ = conn.SetReadDeadline(time.Time{})
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := context.Cause(pingCtx)
+	if h.OnFailure != nil {
+		h.OnFailure(err)
+	} else {
+		_ = conn.Close()
+	}
+
+	return err
+}
+
+type heartbeat struct {
+	*Heartbeat
+	conn   net.Conn
+	cancel context.CancelCauseFunc
+
+	mu       sync.Mutex // serializes writes and guards the fields below
+	seq      uint32     // of the last ping
+	sent     time.Time  // when the last ping was sent
+	answered bool       // whether the last ping received its pong
+	misses   int
+}
+
+// Write sends a ping, ignoring p. Pinger calls it on each interval.
+func (hb *heartbeat) Write(p []byte) (int, error) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	if hb.seq > 0 && !hb.answered {
+		hb.misses++
+
+		max := hb.MaxMisses
+		if max <= 0 {
+			max = defaultMaxMisses
+		}
+
+		if hb.misses >= max {
+			err := fmt.Errorf("%w: %d", ErrMissedHeartbeats, hb.misses)
+			hb.cancel(err)
+
+			return 0, err
+		}
+	}
+
+	hb.seq++
+	hb.sent = time.Now()
+	hb.answered = false
+
+	err := hb.send("ping", hb.seq)
+	if err != nil {
+		hb.cancel(err)
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// send writes a message. The caller must hold hb.mu.
+func (hb *heartbeat) send(kind string, seq uint32) error {
+	b := binary.BigEndian.AppendUint32([]byte(kind), seq)
+	_, err := hb.conn.Write(b)
+
+	return err
+}
+
+// read answers pings and records pongs until reading fails.
+func (hb *heartbeat) read() {
+	var b [8]byte
+
+	for {
+		_, err := io.ReadFull(hb.conn, b[:])
+		if err != nil {
+			hb.cancel(err)
+			return
+		}
+
+		seq := binary.BigEndian.Uint32(b[4:])
+
+		switch string(b[:4]) {
+		case "ping":
+			hb.mu.Lock()
+			err = hb.send("pong", seq)
+			hb.mu.Unlock()
+
+			if err != nil {
+				hb.cancel(err)
+				return
+			}
+		case "pong":
+			hb.mu.Lock()
+			answered := seq == hb.seq && !hb.answered // ignore late pongs
+			if answered {
+				hb.answered = true
+				hb.misses = 0
+			}
+			rtt := time.Since(hb.sent)
+			hb.mu.Unlock()
+
+			if answered && hb.OnRTT != nil {
+				hb.OnRTT(rtt)
+			}
+		default:
+			hb.cancel(fmt.Errorf("%w: %q", ErrInvalidHeartbeat, b[:4]))
+			return
+		}
+	}
+}
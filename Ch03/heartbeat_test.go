@@ -0,0 +1,177 @@
+package ch03
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// connPair returns both ends of a TCP connection over the loopback
+// interface.
+func connPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	return client, server
+}
+
+func TestHeartbeat(t *testing.T) {
+	client, server := connPair(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rtts := make(chan time.Duration, 100)
+	errs := make(chan error, 2)
+
+	for _, conn := range []net.Conn{client, server} {
+		reset := make(chan time.Duration, 1)
+		reset <- 10 * time.Millisecond
+
+		h := Heartbeat{OnRTT: func(rtt time.Duration) {
+			select {
+			case rtts <- rtt:
+			default:
+			}
+		}}
+
+		go func() { errs <- h.Run(ctx, conn, reset) }()
+	}
+
+	// Both peers measure round-trip times.
+	for i := 0; i < 6; i++ {
+		select {
+		case rtt := <-rtts:
+			if rtt <= 0 || rtt > time.Second {
+				t.Errorf("unexpected round-trip time %s", rtt)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for pongs")
+		}
+	}
+
+	cancel()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled; actual %v", err)
+		}
+	}
+
+	// Canceling the context leaves the connection usable.
+	_, err := client.Write([]byte("still open"))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHeartbeatMissed(t *testing.T) {
+	client, server := connPair(t)
+
+	// The server reads the pings but never answers them.
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+
+	reset := make(chan time.Duration, 1)
+	reset <- 10 * time.Millisecond
+
+	h := Heartbeat{MaxMisses: 2}
+	begin := time.Now()
+
+	err := h.Run(context.Background(), client, reset)
+	if !errors.Is(err, ErrMissedHeartbeats) {
+		t.Fatalf("expected ErrMissedHeartbeats; actual %v", err)
+	}
+
+	// The first ping goes out after one interval, and the two misses are
+	// counted at the following two.
+	if elapsed := time.Since(begin); elapsed < 30*time.Millisecond {
+		t.Errorf("gave up after %s; expected at least 30ms", elapsed)
+	}
+
+	// Without an OnFailure callback, Run closes the connection.
+	_, err = client.Write([]byte("closed"))
+	if !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected net.ErrClosed; actual %v", err)
+	}
+}
+
+func TestHeartbeatReset(t *testing.T) {
+	client, server := connPair(t)
+
+	// The server answers pings but never sends its own.
+	go func() {
+		reset := make(chan time.Duration, 1)
+		reset <- time.Hour
+
+		_ = (&Heartbeat{}).Run(context.Background(), server, reset)
+	}()
+
+	var (
+		reset    = make(chan time.Duration, 1)
+		failures = make(chan error, 1)
+		rtts     = make(chan time.Duration, 1)
+	)
+
+	h := Heartbeat{
+		OnRTT: func(rtt time.Duration) {
+			select {
+			case rtts <- rtt:
+			default:
+			}
+		},
+		OnFailure: func(err error) { failures <- err },
+	}
+
+	reset <- time.Hour
+
+	errs := make(chan error, 1)
+	go func() { errs <- h.Run(context.Background(), client, reset) }()
+
+	// Shortening the interval through the reset channel starts the pings.
+	reset <- 10 * time.Millisecond
+
+	select {
+	case <-rtts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a pong")
+	}
+
+	// The server closing its side of the connection ends the heartbeat, and
+	// OnFailure receives the reason instead of Run closing the connection.
+	_ = server.(*net.TCPConn).CloseWrite()
+
+	err := <-errs
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF; actual %v", err)
+	}
+
+	if fErr := <-failures; fErr != err {
+		t.Errorf("expected OnFailure to receive %v; actual %v", err, fErr)
+	}
+
+	_, err = client.Write([]byte("still open"))
+	if err != nil {
+		t.Errorf("expected the connection open; actual %v", err)
+	}
+}
@@ -23,11 +23,9 @@ func Pinger(ctx context.Context, w io.Writer, reset <-chan time.Duration) {
 	}
 
 	timer := time.NewTimer(interval)
-	defer func() {
-		if !timer.Stop() {
-			<-timer.C
-		}
-	}()
+	// Draining the channel here would block forever if we return after the
+	// timer fired. Since Go 1.23, stopping the timer suffices.
+	defer timer.Stop()
 	for {
 		select {
 		case <-ctx.Done():
@@ -41,7 +39,8 @@ func Pinger(ctx context.Context, w io.Writer, reset <-chan time.Duration) {
 			}
 		case <-timer.C:
 			if _, err := w.Write([]byte("ping")); err != nil {
-				// track and act on consecutive timeouts here
+				// The writer decides when consecutive failures warrant giving
+				// up. Heartbeat's writer fails after too many missed pongs.
 				return
 			}
 		}
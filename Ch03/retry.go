@@ -0,0 +1,155 @@
+package ch03
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+)
+
+// RetryDialer dials connections, retrying failed attempts after an
+// exponentially increasing backoff.
+type RetryDialer struct {
+	// Dialer makes each attempt.
+	Dialer net.Dialer
+
+	// MaxAttempts is the number of attempts to make. 0 means 5.
+	MaxAttempts int
+
+	// InitialBackoff is the wait after the first failed attempt. Each
+	// subsequent wait is Multiplier times the previous one, up to MaxBackoff.
+	// They default to 100ms, 2, and 10s.
+	InitialBackoff time.Duration
+	Multiplier     float64
+	MaxBackoff     time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of each backoff to randomly
+	// subtract from it so clients that failed together don't retry together.
+	Jitter float64
+
+	// Timeout, if positive, limits the time spent on all attempts and
+	// backoffs combined, in addition to any deadline on DialContext's context.
+	Timeout time.Duration
+
+	// Retryable reports whether to retry after err. nil means retrying
+	// timeouts, temporary errors, and refused or reset connections.
+	Retryable func(err error) bool
+}
+
+// DialContext connects to address on the named network. If every attempt
+// fails, or an error isn't retryable, or the context ends, the returned error
+// wraps each attempt's error, and the context's error if it ended.
+func (d *RetryDialer) DialContext(ctx context.Context, network,
+	address string) (net.Conn, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	maxAttempts := d.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	retryable := d.Retryable
+	if retryable == nil {
+		retryable = isRetryable
+	}
+
+	var (
+		errs   []error // one per attempt
+		ctxErr error
+	)
+
+	for attempt := 1; ; attempt++ {
+		conn, err := d.Dialer.DialContext(ctx, network, address)
+		if err == nil {
+			return conn, nil
+		}
+
+		errs = append(errs, err)
+
+		if attempt == maxAttempts || !retryable(err) {
+			break
+		}
+
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			break
+		}
+
+		wait := d.Backoff(attempt)
+
+		// Don't bother waiting if the deadline would pass first.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			ctxErr = context.DeadlineExceeded
+			break
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			break
+		}
+	}
+
+	if ctxErr != nil {
+		return nil, fmt.Errorf("dial %s %s: %w after %d attempts: %w", network,
+			address, ctxErr, len(errs), errors.Join(errs...))
+	}
+
+	return nil, fmt.Errorf("dial %s %s: %d attempts failed: %w", network,
+		address, len(errs), errors.Join(errs...))
+}
+
+// Backoff returns the time to wait after the given failed attempt, numbered
+// from 1, including jitter.
+func (d *RetryDialer) Backoff(attempt int) time.Duration {
+	initial := delay(d.InitialBackoff, defaultInitialBackoff)
+	maxBackoff := delay(d.MaxBackoff, defaultMaxBackoff)
+
+	multiplier := d.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	backoff := math.Min(float64(initial)*math.Pow(multiplier, float64(attempt-1)),
+		float64(maxBackoff))
+
+	if jitter := math.Min(math.Max(d.Jitter, 0), 1); jitter > 0 {
+		backoff -= backoff * jitter * rand.Float64()
+	}
+
+	return time.Duration(backoff)
+}
+
+// isRetryable reports whether err is a timeout or temporary error, or a
+// refused or reset connection, any of which may succeed on another attempt.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var nErr net.Error
+	if errors.As(err, &nErr) && (nErr.Timeout() || nErr.Temporary()) {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
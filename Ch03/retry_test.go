@@ -0,0 +1,205 @@
+package ch03
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// failing returns a Control function that fails the first n attempts with the
+// errors from newErr.
+func failing(n int, newErr func(attempt int) error) func(string, string,
+	syscall.RawConn) error {
+	attempt := 0
+
+	return func(_, _ string, _ syscall.RawConn) error {
+		attempt++
+		if attempt <= n {
+			return newErr(attempt)
+		}
+
+		return nil
+	}
+}
+
+func temporaryErr(attempt int) error {
+	return &net.DNSError{
+		Err:         fmt.Sprintf("attempt %d failed", attempt),
+		IsTemporary: true,
+	}
+}
+
+func TestRetryDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	d := RetryDialer{
+		Dialer:         net.Dialer{Control: failing(2, temporaryErr)},
+		InitialBackoff: 20 * time.Millisecond,
+	}
+
+	start := time.Now()
+
+	conn, err := d.DialContext(context.Background(), "tcp",
+		listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	// The third attempt succeeds after backoffs of 20ms and 40ms.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("expected at least 60ms of backoff; actual %s", elapsed)
+	}
+}
+
+func TestRetryDialerMaxAttempts(t *testing.T) {
+	d := RetryDialer{
+		Dialer:         net.Dialer{Control: failing(10, temporaryErr)},
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+
+	_, err := d.DialContext(context.Background(), "tcp", "127.0.0.1:1")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// Every attempt's error is reported.
+	for i := 1; i <= 3; i++ {
+		if !strings.Contains(err.Error(), temporaryErr(i).Error()) {
+			t.Errorf("expected attempt %d's error in %q", i, err)
+		}
+	}
+
+	if strings.Contains(err.Error(), temporaryErr(4).Error()) {
+		t.Errorf("expected no more than 3 attempts: %q", err)
+	}
+
+	if !strings.Contains(err.Error(), "3 attempts failed") {
+		t.Errorf("expected 3 attempts counted in %q", err)
+	}
+}
+
+func TestRetryDialerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The second attempt cancels the context, so no third attempt is made.
+	attempts := 0
+
+	d := RetryDialer{
+		Dialer: net.Dialer{Control: func(_, _ string, _ syscall.RawConn) error {
+			attempts++
+			if attempts == 2 {
+				cancel()
+			}
+
+			return temporaryErr(attempts)
+		}},
+		InitialBackoff: time.Millisecond,
+	}
+
+	_, err := d.DialContext(ctx, "tcp", "127.0.0.1:1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled; actual %v", err)
+	}
+
+	// The context's error isn't counted as an attempt.
+	if !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Errorf("expected 2 attempts counted in %q", err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts; actual %d", attempts)
+	}
+}
+
+func TestRetryDialerNotRetryable(t *testing.T) {
+	permanent := errors.New("permanent")
+	attempts := 0
+
+	d := RetryDialer{
+		Dialer: net.Dialer{Control: func(_, _ string, _ syscall.RawConn) error {
+			attempts++
+			return permanent
+		}},
+		InitialBackoff: time.Millisecond,
+	}
+
+	_, err := d.DialContext(context.Background(), "tcp", "127.0.0.1:1")
+	if !errors.Is(err, permanent) {
+		t.Errorf("expected the permanent error wrapped; actual %v", err)
+	}
+
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt; actual %d", attempts)
+	}
+}
+
+func TestRetryDialerTimeout(t *testing.T) {
+	// Nothing listens on the port, so each attempt is refused.
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	d := RetryDialer{
+		MaxAttempts:    100,
+		InitialBackoff: 20 * time.Millisecond,
+		Timeout:        100 * time.Millisecond,
+	}
+
+	start := time.Now()
+
+	_, err = d.DialContext(context.Background(), "tcp", addr)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded; actual %v", err)
+	}
+
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("expected the refused attempts wrapped; actual %v", err)
+	}
+
+	// It gives up once the next backoff would pass the deadline rather than
+	// waiting for it.
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("expected to give up within 100ms; actual %s", elapsed)
+	}
+}
+
+func TestRetryDialerBackoff(t *testing.T) {
+	d := RetryDialer{
+		InitialBackoff: 100 * time.Millisecond,
+		Multiplier:     3,
+		MaxBackoff:     time.Second,
+	}
+
+	for attempt, expected := range []time.Duration{
+		100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond,
+		time.Second, time.Second,
+	} {
+		if actual := d.Backoff(attempt + 1); actual != expected {
+			t.Errorf("attempt %d: expected %s; actual %s", attempt+1, expected,
+				actual)
+		}
+	}
+
+	d.Jitter = 0.5
+
+	for i := 0; i < 100; i++ {
+		b := d.Backoff(2)
+		if b < 150*time.Millisecond || b > 300*time.Millisecond {
+			t.Fatalf("expected a backoff between 150ms and 300ms; actual %s", b)
+		}
+	}
+}
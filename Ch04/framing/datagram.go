@@ -0,0 +1,65 @@
+package framing
+
+import (
+	"bytes"
+	"io"
+)
+
+// MaxDatagramSize is the largest frame a Datagram Framer reads or writes
+// unless its MaxFrameSize field is set.
+const MaxDatagramSize = 65535
+
+// Datagram frames are the datagrams of a message-oriented connection, such as
+// a UDP or unixgram net.Conn, so they need no framing on the wire. It gives
+// such connections the same Framer interface as stream-oriented ones.
+type Datagram struct {
+	MaxFrameSize int // 0 means MaxDatagramSize
+
+	rw  io.ReadWriter
+	buf []byte
+}
+
+// NewDatagram returns a Datagram Framer over conn.
+func NewDatagram(conn io.ReadWriter) *Datagram {
+	return &Datagram{rw: conn}
+}
+
+func (f *Datagram) max() int {
+	if f.MaxFrameSize <= 0 {
+		return MaxDatagramSize
+	}
+
+	return f.MaxFrameSize
+}
+
+// ReadFrame reads the next datagram. Since the operating system silently
+// truncates datagrams larger than the read buffer, ReadFrame reads into a
+// buffer one byte larger than the maximum frame size to detect them.
+func (f *Datagram) ReadFrame() ([]byte, error) {
+	max := f.max()
+	if len(f.buf) != max+1 {
+		f.buf = make([]byte, max+1)
+	}
+
+	n, err := f.rw.Read(f.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > max {
+		return nil, ErrFrameTooLarge
+	}
+
+	return bytes.Clone(f.buf[:n]), nil
+}
+
+func (f *Datagram) WriteFrame(p []byte) error {
+	max := f.max()
+	if len(p) > max {
+		return tooLarge(uint64(len(p)), max)
+	}
+
+	_, err := f.rw.Write(p)
+
+	return err
+}
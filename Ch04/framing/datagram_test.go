@@ -0,0 +1,55 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestDatagram(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = server.Close() }()
+
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	// An unconnected UDPConn reads datagrams from any sender.
+	r := NewDatagram(server.(*net.UDPConn))
+	r.MaxFrameSize = 10
+	w := NewDatagram(client)
+
+	for _, p := range [][]byte{[]byte("ping"), {}, []byte("0123456789")} {
+		err = w.WriteFrame(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := r.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(actual, p) {
+			t.Errorf("expected %q; actual %q", p, actual)
+		}
+	}
+
+	// The operating system truncates the oversized datagram, which the
+	// Framer detects.
+	err = w.WriteFrame([]byte("0123456789A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.ReadFrame()
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected ErrFrameTooLarge; actual %v", err)
+	}
+}
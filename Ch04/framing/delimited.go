@@ -0,0 +1,98 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrDelimiterInFrame is returned when writing a frame that contains its
+// Delimited Framer's delimiter.
+var ErrDelimiterInFrame = errors.New("frame contains the delimiter")
+
+// Delimited frames are terminated by a delimiter, which they may not contain.
+type Delimited struct {
+	MaxFrameSize int // 0 means DefaultMaxFrameSize; excludes the delimiter
+
+	delim []byte
+	r     *bufio.Reader
+	w     io.Writer
+}
+
+// NewDelimited returns a Delimited Framer over rw that terminates frames with
+// delim. It panics if delim is empty.
+func NewDelimited(rw io.ReadWriter, delim []byte) *Delimited {
+	if len(delim) == 0 {
+		panic("framing: empty delimiter")
+	}
+
+	return &Delimited{
+		delim: bytes.Clone(delim),
+		r:     bufio.NewReader(rw),
+		w:     rw,
+	}
+}
+
+// NewLines returns a Delimited Framer over rw that reads and writes
+// newline-terminated lines.
+func NewLines(rw io.ReadWriter) *Delimited {
+	return NewDelimited(rw, []byte("\n"))
+}
+
+func (f *Delimited) ReadFrame() ([]byte, error) {
+	var (
+		frame []byte
+		last  = f.delim[len(f.delim)-1]
+		max   = maxFrameSize(f.MaxFrameSize)
+	)
+
+	for {
+		// ReadSlice stops at the last byte of the delimiter, which ends the
+		// frame if the bytes before it complete the delimiter.
+		chunk, err := f.r.ReadSlice(last)
+		frame = append(frame, chunk...)
+
+		if err == nil && bytes.HasSuffix(frame, f.delim) {
+			frame = frame[:len(frame)-len(f.delim)]
+			if len(frame) > max {
+				return nil, tooLarge(uint64(len(frame)), max)
+			}
+
+			return frame, nil
+		}
+
+		if n := len(frame) - len(f.delim) + 1; n > max {
+			// Not even the rest of a delimiter would make this frame valid.
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, max)
+		}
+
+		switch {
+		case err == nil, errors.Is(err, bufio.ErrBufferFull):
+		case errors.Is(err, io.EOF) && len(frame) > 0:
+			return nil, io.ErrUnexpectedEOF
+		default:
+			return nil, err
+		}
+	}
+}
+
+func (f *Delimited) WriteFrame(p []byte) error {
+	max := maxFrameSize(f.MaxFrameSize)
+	if len(p) > max {
+		return tooLarge(uint64(len(p)), max)
+	}
+
+	b := append(bytes.Clone(p), f.delim...)
+
+	// The first delimiter must be the one terminating the frame, which also
+	// catches frames ending with the start of a self-overlapping delimiter.
+	if bytes.Index(b, f.delim) != len(p) {
+		return ErrDelimiterInFrame
+	}
+
+	_, err := f.w.Write(b)
+
+	return err
+}
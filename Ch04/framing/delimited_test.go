@@ -0,0 +1,60 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDelimitedDelimiterInFrame(t *testing.T) {
+	var buf bytes.Buffer
+
+	f := NewDelimited(&buf, []byte("aba"))
+
+	for _, p := range []string{"xabay", "xab", "ab"} {
+		err := f.WriteFrame([]byte(p))
+		if !errors.Is(err, ErrDelimiterInFrame) {
+			t.Errorf("%q: expected ErrDelimiterInFrame; actual %v", p, err)
+		}
+	}
+
+	// Frames may contain parts of the delimiter.
+	for _, p := range []string{"xa", "bb", "ba"} {
+		err := f.WriteFrame([]byte(p))
+		if err != nil {
+			t.Fatalf("%q: %v", p, err)
+		}
+
+		actual, err := f.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(actual) != p {
+			t.Errorf("expected %q; actual %q", p, actual)
+		}
+	}
+}
+
+func TestDelimitedLongFrame(t *testing.T) {
+	// A frame longer than the bufio.Reader's buffer is still read in full.
+	var (
+		buf   bytes.Buffer
+		frame = bytes.Repeat([]byte("long "), 2000)
+		f     = NewLines(&buf)
+	)
+
+	err := f.WriteFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := f.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(actual, frame) {
+		t.Errorf("expected %d bytes; actual %d bytes", len(frame), len(actual))
+	}
+}
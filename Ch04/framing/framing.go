@@ -0,0 +1,44 @@
+// Package framing splits a byte stream, such as a TCP or Unix domain socket
+// connection, into discrete messages called frames.
+//
+// Each framing reads from a bufio.Reader it wraps around the connection, so
+// once a connection is handed to a Framer, all reads must go through it.
+package framing
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxFrameSize is the largest frame a Framer reads or writes unless its
+// MaxFrameSize field is set.
+const DefaultMaxFrameSize = 1 << 20 // 1 MB
+
+var (
+	ErrFrameTooLarge = errors.New("frame exceeds maximum size")
+	ErrInvalidFrame  = errors.New("invalid frame")
+)
+
+// Framer reads and writes frames. ReadFrame returns io.EOF if the stream ends
+// between frames and io.ErrUnexpectedEOF if it ends within one.
+//
+// ReadFrame must not be called concurrently. Each WriteFrame makes a single
+// call to Write, so it's safe for concurrent use if the underlying writer is,
+// as a net.Conn is.
+type Framer interface {
+	ReadFrame() ([]byte, error)
+	WriteFrame(p []byte) error
+}
+
+// maxFrameSize returns max, or DefaultMaxFrameSize if max isn't positive.
+func maxFrameSize(max int) int {
+	if max <= 0 {
+		return DefaultMaxFrameSize
+	}
+
+	return max
+}
+
+func tooLarge(size uint64, max int) error {
+	return fmt.Errorf("%w: %d > %d bytes", ErrFrameTooLarge, size, max)
+}
@@ -0,0 +1,169 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// pipe returns both ends of a TCP connection over the loopback interface.
+func pipe(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	return client, server
+}
+
+var framers = map[string]func(io.ReadWriter) Framer{
+	"varint":    func(rw io.ReadWriter) Framer { return NewLengthPrefixed(rw, Varint) },
+	"uint16":    func(rw io.ReadWriter) Framer { return NewLengthPrefixed(rw, Uint16) },
+	"uint32":    func(rw io.ReadWriter) Framer { return NewLengthPrefixed(rw, Uint32) },
+	"lines":     func(rw io.ReadWriter) Framer { return NewLines(rw) },
+	"crlf":      func(rw io.ReadWriter) Framer { return NewDelimited(rw, []byte("\r\n")) },
+	"netstring": func(rw io.ReadWriter) Framer { return NewNetstring(rw) },
+}
+
+func TestFramers(t *testing.T) {
+	frames := [][]byte{
+		[]byte("The bigger the interface,"),
+		{},
+		[]byte("the weaker the abstraction."),
+		bytes.Repeat([]byte("x"), 10000), // spans several reads
+	}
+
+	for name, newFramer := range framers {
+		t.Run(name, func(t *testing.T) {
+			client, server := pipe(t)
+			w, r := newFramer(client), newFramer(server)
+
+			// Concurrent writers must not interleave their frames.
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					for _, f := range frames {
+						if err := w.WriteFrame(f); err != nil {
+							t.Error(err)
+						}
+					}
+				}()
+			}
+
+			go func() {
+				wg.Wait()
+				_ = client.Close()
+			}()
+
+			counts := make(map[string]int)
+			for {
+				f, err := r.ReadFrame()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				counts[string(f)]++
+			}
+
+			for _, f := range frames {
+				if c := counts[string(f)]; c != 4 {
+					t.Errorf("expected frame %.20q 4 times; actual %d", f, c)
+				}
+			}
+
+			if len(counts) != len(frames) {
+				t.Errorf("expected %d distinct frames; actual %d", len(frames),
+					len(counts))
+			}
+		})
+	}
+}
+
+func TestFramersMaxFrameSize(t *testing.T) {
+	for name, newFramer := range framers {
+		t.Run(name, func(t *testing.T) {
+			var (
+				buf bytes.Buffer
+				big = bytes.Repeat([]byte("x"), 101)
+			)
+
+			err := newFramer(&buf).WriteFrame(big)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f := newFramer(&buf)
+			setMax(f, 100)
+
+			_, err = f.ReadFrame()
+			if !errors.Is(err, ErrFrameTooLarge) {
+				t.Errorf("expected ErrFrameTooLarge reading; actual %v", err)
+			}
+
+			err = f.WriteFrame(big)
+			if !errors.Is(err, ErrFrameTooLarge) {
+				t.Errorf("expected ErrFrameTooLarge writing; actual %v", err)
+			}
+		})
+	}
+}
+
+func setMax(f Framer, max int) {
+	switch f := f.(type) {
+	case *LengthPrefixed:
+		f.MaxFrameSize = max
+	case *Delimited:
+		f.MaxFrameSize = max
+	case *Netstring:
+		f.MaxFrameSize = max
+	case *Datagram:
+		f.MaxFrameSize = max
+	}
+}
+
+func TestFramersTruncated(t *testing.T) {
+	for name, newFramer := range framers {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			err := newFramer(&buf).WriteFrame([]byte("truncated"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buf.Truncate(buf.Len() - 1)
+
+			_, err = newFramer(&buf).ReadFrame()
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("expected io.ErrUnexpectedEOF; actual %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package framing
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// Prefix is the encoding of a frame's length.
+type Prefix int
+
+const (
+	Varint Prefix = iota // an unsigned varint, as encoding/binary encodes it
+	Uint16               // 2 bytes, big-endian
+	Uint32               // 4 bytes, big-endian
+)
+
+// LengthPrefixed frames are preceded by their length in bytes.
+type LengthPrefixed struct {
+	MaxFrameSize int // 0 means DefaultMaxFrameSize
+
+	prefix Prefix
+	r      *bufio.Reader
+	w      io.Writer
+}
+
+// NewLengthPrefixed returns a LengthPrefixed Framer over rw that encodes the
+// frame lengths as prefix.
+func NewLengthPrefixed(rw io.ReadWriter, prefix Prefix) *LengthPrefixed {
+	return &LengthPrefixed{prefix: prefix, r: bufio.NewReader(rw), w: rw}
+}
+
+func (f *LengthPrefixed) ReadFrame() ([]byte, error) {
+	size, err := f.readSize()
+	if err != nil {
+		return nil, err
+	}
+
+	max := maxFrameSize(f.MaxFrameSize)
+	if size > uint64(max) {
+		return nil, tooLarge(size, max)
+	}
+
+	frame := make([]byte, size)
+
+	_, err = io.ReadFull(f.r, frame)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+func (f *LengthPrefixed) readSize() (uint64, error) {
+	switch f.prefix {
+	case Varint:
+		size, err := binary.ReadUvarint(f.r)
+		if err != nil && !errors.Is(err, io.EOF) &&
+			!errors.Is(err, io.ErrUnexpectedEOF) {
+			err = errors.Join(ErrInvalidFrame, err) // overflow
+		}
+
+		return size, err
+	case Uint16:
+		var b [2]byte
+
+		_, err := io.ReadFull(f.r, b[:])
+
+		return uint64(binary.BigEndian.Uint16(b[:])), err
+	default:
+		var b [4]byte
+
+		_, err := io.ReadFull(f.r, b[:])
+
+		return uint64(binary.BigEndian.Uint32(b[:])), err
+	}
+}
+
+func (f *LengthPrefixed) WriteFrame(p []byte) error {
+	// Compare in uint64 so the Uint32 limit doesn't overflow int on
+	// 32-bit platforms. The clamped limit always fits in an int.
+	max := uint64(maxFrameSize(f.MaxFrameSize))
+
+	switch f.prefix {
+	case Uint16:
+		max = min(max, math.MaxUint16)
+	case Uint32:
+		max = min(max, math.MaxUint32)
+	}
+
+	if uint64(len(p)) > max {
+		return tooLarge(uint64(len(p)), int(max))
+	}
+
+	b := make([]byte, 0, binary.MaxVarintLen64+len(p))
+
+	switch f.prefix {
+	case Varint:
+		b = binary.AppendUvarint(b, uint64(len(p)))
+	case Uint16:
+		b = binary.BigEndian.AppendUint16(b, uint16(len(p)))
+	default:
+		b = binary.BigEndian.AppendUint32(b, uint32(len(p)))
+	}
+
+	_, err := f.w.Write(append(b, p...))
+
+	return err
+}
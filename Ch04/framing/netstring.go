@@ -0,0 +1,87 @@
+package framing
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Netstring frames are netstrings: the frame's length in decimal, a colon, the
+// frame, and a comma. For example, "5:hello,".
+type Netstring struct {
+	MaxFrameSize int // 0 means DefaultMaxFrameSize
+
+	r *bufio.Reader
+	w io.Writer
+}
+
+// NewNetstring returns a Netstring Framer over rw.
+func NewNetstring(rw io.ReadWriter) *Netstring {
+	return &Netstring{r: bufio.NewReader(rw), w: rw}
+}
+
+func (f *Netstring) ReadFrame() ([]byte, error) {
+	var (
+		size uint64
+		max  = maxFrameSize(f.MaxFrameSize)
+	)
+
+	for i := 0; ; i++ {
+		c, err := f.r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return nil, err
+		}
+
+		if c == ':' && i > 0 {
+			break
+		}
+
+		// Leading zeros aren't allowed.
+		if c < '0' || c > '9' || (i == 1 && size == 0) {
+			return nil, fmt.Errorf("%w: unexpected %q in length", ErrInvalidFrame, c)
+		}
+
+		size = size*10 + uint64(c-'0')
+		if size > uint64(max) {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, max)
+		}
+	}
+
+	frame := make([]byte, size+1)
+
+	_, err := io.ReadFull(f.r, frame)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if frame[size] != ',' {
+		return nil, fmt.Errorf("%w: missing trailing comma", ErrInvalidFrame)
+	}
+
+	return frame[:size], nil
+}
+
+func (f *Netstring) WriteFrame(p []byte) error {
+	max := maxFrameSize(f.MaxFrameSize)
+	if len(p) > max {
+		return tooLarge(uint64(len(p)), max)
+	}
+
+	b := make([]byte, 0, len(p)+22)
+	b = strconv.AppendInt(b, int64(len(p)), 10)
+	b = append(b, ':')
+	b = append(b, p...)
+
+	_, err := f.w.Write(append(b, ','))
+
+	return err
+}
@@ -0,0 +1,36 @@
+package framing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNetstringInvalid(t *testing.T) {
+	for _, s := range []string{
+		":hello,",   // no length
+		"05:hello,", // leading zero
+		"5x:hello,", // not a digit
+		"5:hello;",  // no trailing comma
+		"3:hello,",  // wrong length
+	} {
+		f := NewNetstring(&rw{strings.NewReader(s)})
+
+		_, err := f.ReadFrame()
+		if !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("%q: expected ErrInvalidFrame; actual %v", s, err)
+		}
+	}
+
+	f := NewNetstring(&rw{strings.NewReader("0:,")})
+
+	p, err := f.ReadFrame()
+	if err != nil || len(p) != 0 {
+		t.Errorf("expected an empty frame; actual %q, %v", p, err)
+	}
+}
+
+// rw is a read-only io.ReadWriter.
+type rw struct{ *strings.Reader }
+
+func (*rw) Write([]byte) (int, error) { return 0, errors.New("read-only") }
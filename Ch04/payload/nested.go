@@ -0,0 +1,237 @@
+package payload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// MaxDepth is the maximum nesting of lists and maps within a payload.
+const MaxDepth = 32
+
+var ErrMaxDepth = errors.New("maximum nesting depth exceeded")
+
+// List is a sequence of payloads. Its value is the payloads' encodings, one
+// after another.
+type List []Payload
+
+// Bytes returns the List's value, or nil if it can't be encoded.
+func (m List) Bytes() []byte {
+	b, _ := m.value()
+
+	return b
+}
+
+func (m List) String() string {
+	s := make([]string, len(m))
+	for i, p := range m {
+		s[i] = p.String()
+	}
+
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+func (m List) WriteTo(w io.Writer) (int64, error) {
+	b, err := m.value()
+	if err != nil {
+		return 0, err
+	}
+
+	return writeValue(w, ListType, b)
+}
+
+func (m List) value() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	for _, p := range m {
+		_, err := p.WriteTo(buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (m *List) ReadFrom(r io.Reader) (int64, error) {
+	vr, n, err := readNested(r)
+	if err != nil {
+		return n, err
+	}
+
+	list := List{}
+	for vr.N > 0 {
+		p, err := vr.decode()
+		if err != nil {
+			return n + vr.read(), err
+		}
+		list = append(list, p)
+	}
+	*m = list
+
+	return n + vr.read(), nil
+}
+
+// Map maps strings to payloads. Its value is each key's String encoding
+// followed by the encoding of its payload, in key order.
+type Map map[string]Payload
+
+// Bytes returns the Map's value, or nil if it can't be encoded.
+func (m Map) Bytes() []byte {
+	b, _ := m.value()
+
+	return b
+}
+
+func (m Map) String() string {
+	s := make([]string, 0, len(m))
+	for _, k := range m.keys() {
+		s = append(s, k+":"+m[k].String())
+	}
+
+	return "map[" + strings.Join(s, " ") + "]"
+}
+
+func (m Map) WriteTo(w io.Writer) (int64, error) {
+	b, err := m.value()
+	if err != nil {
+		return 0, err
+	}
+
+	return writeValue(w, MapType, b)
+}
+
+func (m Map) keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+func (m Map) value() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	for _, k := range m.keys() {
+		_, err := String(k).WriteTo(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = m[k].WriteTo(buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (m *Map) ReadFrom(r io.Reader) (int64, error) {
+	vr, n, err := readNested(r)
+	if err != nil {
+		return n, err
+	}
+
+	mp := Map{}
+	for vr.N > 0 {
+		key, err := vr.decode()
+		if err != nil {
+			return n + vr.read(), err
+		}
+
+		k, ok := key.(*String)
+		if !ok {
+			return n + vr.read(), fmt.Errorf("invalid Map key type %T", key)
+		}
+		if _, ok := mp[string(*k)]; ok {
+			return n + vr.read(), fmt.Errorf("duplicate Map key %q", *k)
+		}
+
+		p, err := vr.decode()
+		if err != nil {
+			return n + vr.read(), err
+		}
+		mp[string(*k)] = p
+	}
+	*m = mp
+
+	return n + vr.read(), nil
+}
+
+// nestedReader reads the payloads within the value of a List or Map. Payloads
+// read from it can be no larger than what's left of the value.
+type nestedReader struct {
+	io.LimitedReader
+	size  uint32 // the size of the value
+	depth int    // the nesting depth of payloads read from it
+}
+
+// read returns the number of bytes read from the value so far.
+func (vr *nestedReader) read() int64 { return int64(vr.size) - vr.N }
+
+// decode decodes the next payload in the value.
+func (vr *nestedReader) decode() (Payload, error) {
+	p, err := Decode(vr)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF // the value ended early
+	}
+
+	return p, err
+}
+
+// readNested reads the 4-byte size of a List or Map and returns a reader for
+// its value.
+func readNested(r io.Reader) (*nestedReader, int64, error) {
+	size, err := readSize(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = checkSize(r, size)
+	if err != nil {
+		return nil, 4, err
+	}
+
+	depth := 1
+	if parent, ok := r.(*nestedReader); ok {
+		depth = parent.depth + 1
+	}
+	if depth > MaxDepth {
+		return nil, 4, ErrMaxDepth
+	}
+
+	vr := &nestedReader{
+		LimitedReader: io.LimitedReader{R: r, N: int64(size)},
+		size:          size,
+		depth:         depth,
+	}
+
+	return vr, 4, nil
+}
+
+// checkSize returns an error if a payload's size exceeds MaxPayloadSize. If r
+// is the value of a List or Map, the limit is what's left of the value
+// instead, and if r is a Decoder's, the limits are the Decoder's. Checking
+// before allocating keeps a small payload from claiming a large nested one.
+func checkSize(r io.Reader, size uint32) error {
+	switch r := r.(type) {
+	case *nestedReader:
+		if int64(size) > r.N {
+			return ErrMaxPayloadSize
+		}
+	case *decoderReader:
+		return (*Decoder)(r).checkSize(size)
+	default:
+		if size > MaxPayloadSize {
+			return ErrMaxPayloadSize
+		}
+	}
+
+	return nil
+}
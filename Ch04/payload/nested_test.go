@@ -0,0 +1,129 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNestedPayloads(t *testing.T) {
+	var (
+		s1 = String("gopher")
+		i1 = Int(-7)
+		b1 = Binary("Don't panic.")
+		t1 = Bool(true)
+		l1 = List{&i1, &s1}
+		m1 = Map{"name": &s1, "tags": &l1, "empty": &List{}}
+		l2 = List{&m1, &b1, &t1, &Map{}}
+	)
+
+	buf := new(bytes.Buffer)
+
+	_, err := l2.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&l2, actual) {
+		t.Errorf("value mismatch: %v != %v", &l2, actual)
+	}
+
+	if expected := "[map[empty:[] name:gopher tags:[-7 gopher]] Don't panic. true map[]]"; actual.String() != expected {
+		t.Errorf("expected %q; actual %q", expected, actual)
+	}
+}
+
+func TestNestedMaxPayloadSize(t *testing.T) {
+	// Writing a List larger than MaxPayloadSize fails, even though each of
+	// its elements is small enough.
+	half := Binary(make([]byte, MaxPayloadSize/2))
+
+	_, err := List{&half, &half, &half}.WriteTo(new(bytes.Buffer))
+	if !errors.Is(err, ErrMaxPayloadSize) {
+		t.Errorf("expected ErrMaxPayloadSize; actual: %v", err)
+	}
+
+	// A List can't contain a payload larger than itself.
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{ListType, 0, 0, 0, 10, BinaryType})
+	_ = binary.Write(buf, binary.BigEndian, uint32(1<<20)) // 1 MB
+
+	_, err = Decode(buf)
+	if !errors.Is(err, ErrMaxPayloadSize) {
+		t.Errorf("expected ErrMaxPayloadSize; actual: %v", err)
+	}
+
+	// A List's value can't end in the middle of a payload.
+	s1 := String("truncated")
+	buf.Reset()
+	buf.Write([]byte{ListType, 0, 0, 0, 8})
+	_, _ = s1.WriteTo(buf)
+
+	_, err = Decode(buf)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestNestedMaxDepth(t *testing.T) {
+	build := func(depth int) []byte {
+		var p Payload = &List{}
+		for i := 1; i < depth; i++ {
+			p = &List{p}
+		}
+
+		buf := new(bytes.Buffer)
+
+		_, err := p.WriteTo(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return buf.Bytes()
+	}
+
+	_, err := Decode(bytes.NewReader(build(MaxDepth)))
+	if err != nil {
+		t.Errorf("depth %d: %v", MaxDepth, err)
+	}
+
+	_, err = Decode(bytes.NewReader(build(MaxDepth + 1)))
+	if !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("expected ErrMaxDepth; actual: %v", err)
+	}
+}
+
+func TestMapInvalid(t *testing.T) {
+	i1 := Int(1)
+	buf := new(bytes.Buffer)
+
+	// a key that isn't a String
+	value := List{&i1, &i1}.Bytes()
+	buf.Write([]byte{MapType, 0, 0, 0, byte(len(value))})
+	buf.Write(value)
+
+	_, err := Decode(buf)
+	if err == nil || !strings.Contains(err.Error(), "key type") {
+		t.Errorf("expected an invalid key error; actual: %v", err)
+	}
+
+	// a duplicate key
+	k := String("k")
+	value = List{&k, &i1, &k, &i1}.Bytes()
+	buf.Reset()
+	buf.Write([]byte{MapType, 0, 0, 0, byte(len(value))})
+	buf.Write(value)
+
+	_, err = Decode(buf)
+	if err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("expected a duplicate key error; actual: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package payload
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Int is a signed 64-bit integer.
+type Int int64
+
+func (m Int) Bytes() []byte  { return binary.BigEndian.AppendUint64(nil, uint64(m)) }
+func (m Int) String() string { return strconv.FormatInt(int64(m), 10) }
+
+func (m Int) WriteTo(w io.Writer) (int64, error) {
+	return writeValue(w, IntType, m.Bytes())
+}
+
+func (m *Int) ReadFrom(r io.Reader) (int64, error) {
+	var b [8]byte
+
+	n, err := readFixed(r, b[:], "Int")
+	if err != nil {
+		return n, err
+	}
+	*m = Int(binary.BigEndian.Uint64(b[:]))
+
+	return n, nil
+}
+
+// Uint is an unsigned 64-bit integer.
+type Uint uint64
+
+func (m Uint) Bytes() []byte  { return binary.BigEndian.AppendUint64(nil, uint64(m)) }
+func (m Uint) String() string { return strconv.FormatUint(uint64(m), 10) }
+
+func (m Uint) WriteTo(w io.Writer) (int64, error) {
+	return writeValue(w, UintType, m.Bytes())
+}
+
+func (m *Uint) ReadFrom(r io.Reader) (int64, error) {
+	var b [8]byte
+
+	n, err := readFixed(r, b[:], "Uint")
+	if err != nil {
+		return n, err
+	}
+	*m = Uint(binary.BigEndian.Uint64(b[:]))
+
+	return n, nil
+}
+
+// Float is a 64-bit IEEE 754 floating-point number.
+type Float float64
+
+func (m Float) Bytes() []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(float64(m)))
+}
+
+func (m Float) String() string { return strconv.FormatFloat(float64(m), 'g', -1, 64) }
+
+func (m Float) WriteTo(w io.Writer) (int64, error) {
+	return writeValue(w, FloatType, m.Bytes())
+}
+
+func (m *Float) ReadFrom(r io.Reader) (int64, error) {
+	var b [8]byte
+
+	n, err := readFixed(r, b[:], "Float")
+	if err != nil {
+		return n, err
+	}
+	*m = Float(math.Float64frombits(binary.BigEndian.Uint64(b[:])))
+
+	return n, nil
+}
+
+// Bool is a boolean, encoded as a single byte: 0 for false or 1 for true.
+type Bool bool
+
+func (m Bool) Bytes() []byte {
+	if m {
+		return []byte{1}
+	}
+
+	return []byte{0}
+}
+
+func (m Bool) String() string { return strconv.FormatBool(bool(m)) }
+
+func (m Bool) WriteTo(w io.Writer) (int64, error) {
+	return writeValue(w, BoolType, m.Bytes())
+}
+
+func (m *Bool) ReadFrom(r io.Reader) (int64, error) {
+	var b [1]byte
+
+	n, err := readFixed(r, b[:], "Bool")
+	if err != nil {
+		return n, err
+	}
+	if b[0] > 1 {
+		return n, errors.New("invalid Bool")
+	}
+	*m = b[0] == 1
+
+	return n, nil
+}
+
+// writeValue writes the 1-byte type, the 4-byte size of value, and value.
+func writeValue(w io.Writer, typ uint8, value []byte) (int64, error) {
+	if uint64(len(value)) > uint64(MaxPayloadSize) {
+		return 0, ErrMaxPayloadSize
+	}
+
+	header := [5]byte{typ}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(value)))
+
+	n, err := w.Write(header[:])
+	if err != nil {
+		return int64(n), err
+	}
+
+	o, err := w.Write(value)
+
+	return int64(n + o), err
+}
+
+// readFixed reads the 4-byte size and the value of a fixed-size type into b,
+// returning an error naming the type if the size isn't len(b).
+func readFixed(r io.Reader, b []byte, name string) (int64, error) {
+	size, err := readSize(r)
+	if err != nil {
+		return 0, err
+	}
+	if size != uint32(len(b)) {
+		return 4, errors.New("invalid " + name)
+	}
+
+	o, err := io.ReadFull(r, b)
+
+	return 4 + int64(o), err
+}
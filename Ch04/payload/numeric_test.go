@@ -0,0 +1,53 @@
+package payload
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNumericPayloads(t *testing.T) {
+	i1, i2 := Int(math.MinInt64), Int(-42)
+	u1 := Uint(math.MaxUint64)
+	f1, f2 := Float(math.Pi), Float(math.Inf(-1))
+	b1, b2 := Bool(true), Bool(false)
+	payloads := []Payload{&i1, &i2, &u1, &f1, &f2, &b1, &b2}
+
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+
+	for _, p := range payloads {
+		err := enc.Encode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := NewDecoder(buf)
+
+	for _, expected := range payloads {
+		actual, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("value mismatch: %v != %v", expected, actual)
+		}
+	}
+}
+
+func TestNumericPayloadsInvalid(t *testing.T) {
+	for _, b := range [][]byte{
+		{IntType, 0, 0, 0, 4, 0, 0, 0, 1},  // wrong size
+		{FloatType, 0, 0, 0, 0},            // wrong size
+		{BoolType, 0, 0, 0, 1, 2},          // neither 0 nor 1
+		{UintType, 0, 0, 0, 8, 0, 0, 0, 1}, // truncated
+	} {
+		_, err := Decode(bytes.NewReader(b))
+		if err == nil {
+			t.Errorf("%v: expected an error", b)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package payload
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrTypeRegistered = errors.New("payload type already registered")
+	ErrUnknownType    = errors.New("unknown type")
+)
+
+// registry maps each type byte to a function returning a new Payload of that
+// type, ready for its ReadFrom method.
+var registry = struct {
+	sync.RWMutex
+	factories map[uint8]func() Payload
+}{
+	factories: map[uint8]func() Payload{
+		BinaryType: func() Payload { return new(Binary) },
+		StringType: func() Payload { return new(String) },
+		IntType:    func() Payload { return new(Int) },
+		UintType:   func() Payload { return new(Uint) },
+		FloatType:  func() Payload { return new(Float) },
+		BoolType:   func() Payload { return new(Bool) },
+		ListType:   func() Payload { return new(List) },
+		MapType:    func() Payload { return new(Map) },
+	},
+}
+
+// Register adds a payload type to the protocol so Decode recognizes it. The
+// factory returns a new Payload whose WriteTo method writes typ as its 1-byte
+// type and whose ReadFrom method reads what WriteTo wrote after the type,
+// since Decode has already read it. Register returns
+// an error wrapping ErrTypeRegistered if typ is already registered, including
+// the built-in types.
+func Register(typ uint8, factory func() Payload) error {
+	if factory == nil {
+		return fmt.Errorf("payload type %d: nil factory", typ)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.factories[typ]; ok {
+		return fmt.Errorf("payload type %d: %w", typ, ErrTypeRegistered)
+	}
+
+	registry.factories[typ] = factory
+
+	return nil
+}
+
+// newPayload returns a new Payload of the registered type typ.
+func newPayload(typ uint8) (Payload, error) {
+	registry.RLock()
+	factory, ok := registry.factories[typ]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("payload type %d: %w", typ, ErrUnknownType)
+	}
+
+	return factory(), nil
+}
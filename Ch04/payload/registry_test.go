@@ -0,0 +1,101 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+const pointType uint8 = 200
+
+// point is a custom payload type carrying two coordinates.
+type point struct{ X, Y int32 }
+
+func (p point) Bytes() []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, uint32(p.X))
+	binary.BigEndian.PutUint32(b[4:], uint32(p.Y))
+
+	return b
+}
+
+func (p point) String() string { return fmt.Sprintf("(%d, %d)", p.X, p.Y) }
+
+func (p point) WriteTo(w io.Writer) (int64, error) {
+	b := append([]byte{pointType, 0, 0, 0, 8}, p.Bytes()...)
+	n, err := w.Write(b)
+
+	return int64(n), err
+}
+
+func (p *point) ReadFrom(r io.Reader) (int64, error) {
+	b := make([]byte, 12)
+
+	n, err := io.ReadFull(r, b)
+	if err != nil {
+		return int64(n), err
+	}
+
+	if binary.BigEndian.Uint32(b) != 8 {
+		return int64(n), errors.New("invalid point")
+	}
+
+	p.X = int32(binary.BigEndian.Uint32(b[4:8]))
+	p.Y = int32(binary.BigEndian.Uint32(b[8:]))
+
+	return int64(n), nil
+}
+
+func TestRegister(t *testing.T) {
+	t.Cleanup(func() {
+		registry.Lock()
+		delete(registry.factories, pointType)
+		registry.Unlock()
+	})
+
+	err := Register(pointType, func() Payload { return new(point) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Register(pointType, func() Payload { return new(point) })
+	if !errors.Is(err, ErrTypeRegistered) {
+		t.Errorf("expected ErrTypeRegistered; actual: %v", err)
+	}
+
+	err = Register(BinaryType, func() Payload { return new(point) })
+	if !errors.Is(err, ErrTypeRegistered) {
+		t.Errorf("expected ErrTypeRegistered; actual: %v", err)
+	}
+
+	p1 := point{X: -3, Y: 7}
+	s1 := String("after the point")
+	buf := new(bytes.Buffer)
+
+	for _, p := range []Payload{&p1, &s1} {
+		_, err = p.WriteTo(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []Payload{&p1, &s1} {
+		actual, err := Decode(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("value mismatch: %v != %v", expected, actual)
+		}
+	}
+
+	_, err = Decode(bytes.NewReader([]byte{pointType + 1, 0, 0, 0, 0}))
+	if !errors.Is(err, ErrUnknownType) {
+		t.Errorf("expected ErrUnknownType; actual: %v", err)
+	}
+}
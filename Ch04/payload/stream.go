@@ -0,0 +1,206 @@
+package payload
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Encoder writes payloads to an output stream.
+type Encoder struct {
+	w *bufio.Writer
+}
+
+// NewEncoder returns an Encoder that writes to w. It buffers each payload so
+// writing one takes a single write to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Encode writes p to the stream.
+func (e *Encoder) Encode(p Payload) error {
+	_, err := p.WriteTo(e.w)
+	if err != nil {
+		return err
+	}
+
+	return e.w.Flush()
+}
+
+// Decoder reads payloads from an input stream.
+type Decoder struct {
+	// MaxPayloadSize is the largest payload the Decoder accepts. It bounds
+	// the payloads nested in a List or Map too, since they're part of its
+	// value. If zero, the package's MaxPayloadSize applies.
+	MaxPayloadSize uint32
+
+	// Budget, if positive, is the total number of bytes the Decoder reads
+	// from the stream across all payloads.
+	Budget int64
+
+	r    *bufio.Reader
+	read int64 // bytes of payloads read from r
+}
+
+// NewDecoder returns a Decoder that reads from r. The Decoder buffers its
+// reads, so it may read beyond the payloads it returns.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next payload from the stream. It returns io.EOF if the
+// stream ends between payloads, and io.ErrUnexpectedEOF if the stream ends
+// within one. If a payload exceeds one of the Decoder's limits, Decode
+// returns a *LimitError, after which the stream is no longer usable.
+func (d *Decoder) Decode() (Payload, error) {
+	typ, err := d.nextType()
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = d.r.ReadByte()
+	d.read++
+
+	return decodeType(typ, (*decoderReader)(d))
+}
+
+// DecodeInto reads the next payload from the stream into p, which must have
+// the payload's type. Payloads reuse what they can of their previous value,
+// such as a Binary's buffer, so decoding a stream of payloads into the same p
+// saves allocating each one. If the next payload has another type,
+// DecodeInto returns an error wrapping ErrTypeMismatch without reading it, so
+// Decode can. Otherwise, DecodeInto returns the same errors as Decode.
+func (d *Decoder) DecodeInto(p Payload) error {
+	typ, err := d.nextType()
+	if err != nil {
+		return err
+	}
+
+	expected, err := newPayload(typ)
+	if err != nil {
+		return err
+	}
+
+	if reflect.TypeOf(expected) != reflect.TypeOf(p) {
+		return fmt.Errorf("payload type %d is %T, not %T: %w", typ, expected, p,
+			ErrTypeMismatch)
+	}
+
+	_, _ = d.r.ReadByte()
+	d.read++
+
+	return readPayload(p, (*decoderReader)(d))
+}
+
+// nextType returns the type of the next payload without reading it.
+func (d *Decoder) nextType() (uint8, error) {
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return 0, err // the stream ended between payloads
+	}
+
+	// Every payload has at least a 1-byte type and a 4-byte size.
+	if d.Budget > 0 && d.read+5 > d.Budget {
+		return 0, &LimitError{Limit: BudgetLimit, Size: d.read + 5, Max: d.Budget}
+	}
+
+	return b[0], nil
+}
+
+// maxPayloadSize returns the largest payload the Decoder accepts.
+func (d *Decoder) maxPayloadSize() uint32 {
+	if d.MaxPayloadSize == 0 {
+		return MaxPayloadSize
+	}
+
+	return d.MaxPayloadSize
+}
+
+// checkSize returns a *LimitError if a payload of the given size exceeds one
+// of the Decoder's limits.
+func (d *Decoder) checkSize(size uint32) error {
+	if limit := d.maxPayloadSize(); size > limit {
+		return &LimitError{Limit: PayloadSizeLimit, Size: int64(size), Max: int64(limit)}
+	}
+
+	if d.Budget > 0 && d.read+int64(size) > d.Budget {
+		return &LimitError{Limit: BudgetLimit, Size: d.read + int64(size), Max: d.Budget}
+	}
+
+	return nil
+}
+
+// decoderReader is the reader a Decoder passes to each payload's ReadFrom
+// method. It counts the bytes read and stops at the Decoder's budget, and
+// lets checkSize apply the Decoder's limits.
+type decoderReader Decoder
+
+func (dr *decoderReader) Read(p []byte) (int, error) {
+	d := (*Decoder)(dr)
+
+	if d.Budget > 0 {
+		remaining := d.Budget - d.read
+		if remaining <= 0 {
+			return 0, &LimitError{Limit: BudgetLimit, Size: d.read + int64(len(p)), Max: d.Budget}
+		}
+
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+
+	n, err := d.r.Read(p)
+	d.read += int64(n)
+
+	return n, err
+}
+
+// Limit identifies one of a Decoder's limits.
+type Limit int
+
+const (
+	PayloadSizeLimit Limit = iota + 1 // the Decoder's MaxPayloadSize
+	BudgetLimit                       // the Decoder's Budget
+)
+
+func (l Limit) String() string {
+	switch l {
+	case PayloadSizeLimit:
+		return "maximum payload size"
+	case BudgetLimit:
+		return "byte budget"
+	default:
+		return fmt.Sprintf("Limit(%d)", int(l))
+	}
+}
+
+var (
+	ErrBudgetExceeded = errors.New("byte budget exceeded")
+	ErrTypeMismatch   = errors.New("payload type mismatch")
+)
+
+// LimitError reports a payload that exceeds one of a Decoder's limits. It
+// matches ErrMaxPayloadSize or ErrBudgetExceeded with errors.Is, depending on
+// the limit.
+type LimitError struct {
+	Limit Limit // the limit the payload exceeded
+	Size  int64 // the payload's size, or the total bytes read including it
+	Max   int64 // the limit's value
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s exceeded: %d > %d", e.Limit, e.Size, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool {
+	switch e.Limit {
+	case PayloadSizeLimit:
+		return target == ErrMaxPayloadSize
+	case BudgetLimit:
+		return target == ErrBudgetExceeded
+	}
+
+	return false
+}
@@ -0,0 +1,283 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	b1 := Binary(bytes.Repeat([]byte("Clear is better than clever. "), 1000))
+	b2 := Binary("Don't panic.")
+	s1 := String("Errors are values.")
+	payloads := []Payload{&b1, &s1, &b2}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		enc := NewEncoder(conn)
+
+		for _, p := range payloads {
+			err = enc.Encode(p)
+			if err != nil {
+				t.Error(err)
+				break
+			}
+		}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Deliver the stream a byte at a time to make sure the decoder doesn't
+	// rely on a single read returning a whole payload.
+	dec := NewDecoder(iotest.OneByteReader(conn))
+
+	for _, expected := range payloads {
+		actual, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("value mismatch: %v != %v", expected, actual)
+		}
+	}
+
+	_, err = dec.Decode()
+	if err != io.EOF {
+		t.Errorf("expected io.EOF; actual: %v", err)
+	}
+}
+
+func TestDecoderTruncated(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	_, err := String("truncated").WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{1, 3, 5, buf.Len() - 1} {
+		dec := NewDecoder(bytes.NewReader(buf.Bytes()[:n]))
+
+		_, err = dec.Decode()
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%d bytes: expected io.ErrUnexpectedEOF; actual: %v", n, err)
+		}
+	}
+}
+
+func TestBinaryReadFromReusesBuffer(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	_, err := Binary("short").WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := make(Binary, 0, 64)
+	array := &b[:1][0]
+
+	_, err = b.ReadFrom(bytes.NewReader(buf.Bytes()[1:])) // skip the type
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != "short" {
+		t.Errorf("expected %q; actual %q", "short", b)
+	}
+
+	if &b[0] != array {
+		t.Error("expected ReadFrom to reuse the Binary's array")
+	}
+}
+
+func TestDecoderDecodeInto(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+
+	b1, b2, b3 := Binary("the longest payload first"), Binary("shorter"), Binary("")
+	s := String("not binary")
+	payloads := []Payload{&b1, &b2, &b3, &s}
+
+	for _, p := range payloads {
+		err := enc.Encode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		dec   = NewDecoder(buf)
+		b     Binary
+		array *byte
+	)
+
+	for i, expected := range payloads[:3] {
+		err := dec.DecodeInto(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b, expected.Bytes()) {
+			t.Errorf("expected %q; actual %q", expected, b)
+		}
+
+		// The first payload allocates the array the rest reuse.
+		if i == 0 {
+			array = &b[:1][0]
+		} else if &b[:1][0] != array {
+			t.Errorf("payload %d: expected the Binary's array reused", i)
+		}
+	}
+
+	// A payload of another type is left for Decode.
+	err := dec.DecodeInto(&b)
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch; actual %v", err)
+	}
+
+	p, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.String() != "not binary" {
+		t.Errorf("expected %q; actual %q", "not binary", p)
+	}
+
+	err = dec.DecodeInto(&b)
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF; actual %v", err)
+	}
+}
+
+func TestDecoderMaxPayloadSize(t *testing.T) {
+	small := String("small")
+	large := Binary(make([]byte, MaxPayloadSize+1))
+	list := List{&large}
+
+	buf := new(bytes.Buffer)
+
+	_, err := small.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// List's WriteTo method won't exceed MaxPayloadSize, so write the list
+	// by hand.
+	buf.WriteByte(ListType)
+	_ = binary.Write(buf, binary.BigEndian, uint32(5+len(large)))
+
+	_, err = large.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	// A small limit rejects the list.
+	dec := NewDecoder(bytes.NewReader(b))
+	dec.MaxPayloadSize = 1024
+
+	_, err = dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dec.Decode()
+
+	var lErr *LimitError
+	if !errors.As(err, &lErr) || lErr.Limit != PayloadSizeLimit ||
+		lErr.Max != 1024 || lErr.Size != int64(len(b)-15) {
+		t.Errorf("expected a payload size limit error; actual: %v", err)
+	}
+
+	if !errors.Is(err, ErrMaxPayloadSize) {
+		t.Errorf("expected the error to match ErrMaxPayloadSize: %v", err)
+	}
+
+	// A large limit accepts it, nested payload and all.
+	dec = NewDecoder(bytes.NewReader(b))
+	dec.MaxPayloadSize = 2 * MaxPayloadSize
+
+	for _, expected := range []Payload{&small, &list} {
+		actual, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Error("value mismatch")
+		}
+	}
+}
+
+func TestDecoderBudget(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+
+	for _, s := range []String{"one", "two", "six"} { // 8 bytes each
+		err := enc.Encode(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := buf.Bytes()
+
+	// The budget covers the first two payloads.
+	dec := NewDecoder(bytes.NewReader(b))
+	dec.Budget = 20
+
+	for i := 0; i < 2; i++ {
+		_, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := dec.Decode()
+
+	var lErr *LimitError
+	if !errors.As(err, &lErr) || lErr.Limit != BudgetLimit || lErr.Max != 20 {
+		t.Errorf("expected a budget limit error; actual: %v", err)
+	}
+
+	if !errors.Is(err, ErrBudgetExceeded) || errors.Is(err, ErrMaxPayloadSize) {
+		t.Errorf("expected the error to match only ErrBudgetExceeded: %v", err)
+	}
+
+	// A stream that ends exactly at the budget ends cleanly.
+	dec = NewDecoder(bytes.NewReader(b))
+	dec.Budget = int64(len(b))
+
+	for i := 0; i < 3; i++ {
+		_, err = dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = dec.Decode()
+	if err != io.EOF {
+		t.Errorf("expected io.EOF; actual: %v", err)
+	}
+}
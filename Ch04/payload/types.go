@@ -1,9 +1,11 @@
 // Page 79
 // Listing 4-4: The message struct implements a simple protocol.
-package main
+
+// Package payload implements a type-length-value protocol for sending
+// messages over a TCP connection.
+package payload
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -14,6 +16,12 @@ import (
 const (
 	BinaryType uint8 = iota + 1
 	StringType
+	IntType
+	UintType
+	FloatType
+	BoolType
+	ListType
+	MapType
 
 	// For security purposes, we define a maximum payload size.
 	MaxPayloadSize uint32 = 10 << 20 // 10 MB
@@ -65,27 +73,16 @@ func (m Binary) WriteTo(w io.Writer) (int64, error) {
 
 // Pages 80-81
 // Listing 4-6: Completing the Binary type's implementation.
+// The ReadFrom method reads what WriteTo wrote after the 1-byte type, which
+// Decode has already read to determine the type.
 func (m *Binary) ReadFrom(r io.Reader) (int64, error) {
-	var typ uint8
-	// The ReadFrom method reads 1 byte from the reader into the typ variable.
-	err := binary.Read(r, binary.BigEndian, &typ) // 1-byte type
+	// It reads the first 4 bytes into the size variable, which sizes the
+	// Binary byte slice.
+	size, err := readSize(r) // 4-byte size
 	if err != nil {
 		return 0, err
 	}
-	var n int64 = 1
-	// It next verifies that the type is BinaryType before proceeding.
-	if typ != BinaryType {
-		return n, errors.New("invalid Binary")
-	}
-
-	var size uint32
-	// Then it reads the next 4 bytes into the size variable, which sizes the
-	// new Binary byte slice.
-	err = binary.Read(r, binary.BigEndian, &size) // 4-byte size
-	if err != nil {
-		return n, err
-	}
-	n += 4
+	var n int64 = 4
 	// We enforce a maximum payload size.
 	// This is because the 4-byte integer you use to designate the payload size
 	// has a maximum value of 4,294,967,295, indicating a payload of over 4 GB.
@@ -94,13 +91,20 @@ func (m *Binary) ReadFrom(r io.Reader) (int64, error) {
 	// your computer.
 	// Keeping the maximum payload size reasonable makes memory exhaustion
 	// attacks harder to execute.
-	if size > MaxPayloadSize {
-		return n, ErrMaxPayloadSize
+	err = checkSize(r, size)
+	if err != nil {
+		return n, err
 	}
 
-	*m = make([]byte, size)
-	// Finally, it populates the Binary byte slice.
-	o, err := r.Read(*m) // payload
+	// It reuses the Binary's underlying array if it's large enough.
+	if uint32(cap(*m)) >= size {
+		*m = (*m)[:size]
+	} else {
+		*m = make([]byte, size)
+	}
+	// Finally, it populates the Binary byte slice, reading until it's full
+	// since a single Read may return fewer bytes on a TCP connection.
+	o, err := io.ReadFull(r, *m) // payload
 
 	return n + int64(o), err
 }
@@ -133,74 +137,80 @@ func (m String) WriteTo(w io.Writer) (int64, error) {
 // Page 82
 // Listing 4-8: Completing the String type's implementation.
 func (m *String) ReadFrom(r io.Reader) (int64, error) {
-	var typ uint8
-	err := binary.Read(r, binary.BigEndian, &typ) // 1-byte type
+	size, err := readSize(r) // 4-byte size
 	if err != nil {
 		return 0, err
 	}
-	var n int64 = 1
-	if typ != StringType {
-		return n, errors.New("invalid String")
-	}
-
-	var size uint32
-	err = binary.Read(r, binary.BigEndian, &size) // 4-byte size
+	var n int64 = 4
+	err = checkSize(r, size)
 	if err != nil {
 		return n, err
 	}
-	n += 4
 
 	buf := make([]byte, size)
-	o, err := r.Read(buf) // payload
+	o, err := io.ReadFull(r, buf) // payload
 	if err != nil {
-		return n, err
+		return n + int64(o), err
 	}
 	*m = String(buf)
 
 	return n + int64(o), nil
 }
 
+// readSize reads a 4-byte size.
+func readSize(r io.Reader) (uint32, error) {
+	var b [4]byte
+
+	_, err := io.ReadFull(r, b[:])
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
 // Page 83
 // Listing 4-9: Decoding bytes from a reader into a Binary or String type.
-// The decode function accepts an io.Reader and returns a Payload interface and
+// The Decode function accepts an io.Reader and returns a Payload interface and
 // an error interface.
-// If decode cannot decode the bytes read form the reader into a Binary or
-// String type, it will return an error along with a nil Payload.
-func decode(r io.Reader) (Payload, error) {
-	var typ uint8
+// If Decode cannot decode the bytes read form the reader into a registered
+// type, it will return an error along with a nil Payload.
+func Decode(r io.Reader) (Payload, error) {
+	var typ [1]byte
 	// We first read a byte from the reader to determine the type.
-	err := binary.Read(r, binary.BigEndian, &typ)
+	_, err := io.ReadFull(r, typ[:])
 	if err != nil {
 		return nil, err
 	}
 
-	// Creates a payload variable to hold the decoded type.
-	var payload Payload
-
-	// If the type you read from the reader is an expected type constant, you
-	// assign the corresponding type to the payload variable.
-	switch typ {
-	case BinaryType:
-		payload = new(Binary)
-	case StringType:
-		payload = new(String)
-	default:
-		return nil, errors.New("unknown type")
+	return decodeType(typ[0], r)
+}
+
+// decodeType decodes the rest of a payload of type typ from r.
+func decodeType(typ uint8, r io.Reader) (Payload, error) {
+	// We look up the type in the registry and create a payload variable to
+	// hold the decoded type.
+	payload, err := newPayload(typ)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = payload.ReadFrom(
-		// We use io.MultiReader to concatenate the byte we already read with
-		// the reader.
-		// This is not an optimal use-case.
-		// The proper fix is to remove each type's need to read the first byte
-		// in its ReadFrom method.
-		// Then, the ReadFrom method would read only the 4-byte size and the
-		// payload, eliminating the need to inject the type byte back into the
-		// reader before passing it on to ReadFrom.
-		io.MultiReader(bytes.NewReader([]byte{typ}), r))
+	err = readPayload(payload, r)
 	if err != nil {
 		return nil, err
 	}
 
 	return payload, nil
-}
\ No newline at end of file
+}
+
+// readPayload reads the rest of a payload into p after its type byte.
+func readPayload(p Payload, r io.Reader) error {
+	// Each type's ReadFrom method reads only the 4-byte size and the payload,
+	// so we pass it the reader as is.
+	_, err := p.ReadFrom(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF // the type byte began a payload
+	}
+
+	return err
+}
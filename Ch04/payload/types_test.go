@@ -1,4 +1,4 @@
-package main
+package payload
 
 import (
 	"bytes"
@@ -45,7 +45,7 @@ func TestPayloads(t *testing.T) {
 	defer conn.Close()
 
 	for i := 0; i < len(payloads); i++ {
-		actual, err := decode(conn)
+		actual, err := Decode(conn)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -63,12 +63,7 @@ func TestPayloads(t *testing.T) {
 // Listing 4-12: Testing the maximum payload size.
 func TestMaxPayloadSize(t *testing.T) {
 	buf := new(bytes.Buffer)
-	err := buf.WriteByte(BinaryType)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	err = binary.Write(buf, binary.BigEndian, uint32(1<<30)) // 1 GB
+	err := binary.Write(buf, binary.BigEndian, uint32(1<<30)) // 1 GB
 	if err != nil {
 		t.Fatal(err)
 	}
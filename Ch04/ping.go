@@ -5,17 +5,25 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
+	"strings"
 	"time"
+
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/ping"
 )
 
 var (
 	count    = flag.Int("c", 3, "number of pings: <= 0 means forever")
 	interval = flag.Duration("i", time.Second, "interval between pings")
 	timeout  = flag.Duration("W", 5*time.Second, "time to wait for a reply")
+	keepOn   = flag.Bool("k", false, "keep pinging after non-temporary errors")
+	jsonOut  = flag.Bool("json", false, "print each ping and the summary as JSON")
 )
 
 func init() {
@@ -36,33 +44,117 @@ func main() {
 		os.Exit(1)
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	target := flag.Arg(0)
-	fmt.Println("PING", target)
+	if !*jsonOut {
+		fmt.Println("PING", target)
 
-	if *count <= 0 {
-		fmt.Println("CTRL+C to stop.")
+		if *count <= 0 {
+			fmt.Println("CTRL+C to stop.")
+		}
 	}
 
-	msg := 0
+	var (
+		summary ping.Summary
+		failed  bool
+		enc     = json.NewEncoder(os.Stdout)
+	)
 
-	for *count <= 0 || msg < *count {
-		msg++
-		fmt.Print(msg, " ")
+	for msg := 1; *count <= 0 || msg <= *count; msg++ {
+		if msg > 1 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(*interval):
+			}
+		}
+		if ctx.Err() != nil {
+			break // interrupted; report what we have
+		}
 
-		start := time.Now()
-		c, err := net.DialTimeout("tcp", target, *timeout)
-		dur := time.Since(start)
+		dur, err := ping.TCP(ctx, target, *timeout)
+		if ctx.Err() != nil {
+			break // interrupted mid-dial, which isn't a failed ping
+		}
+		summary.Add(dur, err)
 
-		if err != nil {
-			fmt.Printf("fail in %s: %v\n", dur, err)
-			if nErr, ok := err.(net.Error); !ok || !nErr.Temporary() {
-				os.Exit(1)
+		if *jsonOut {
+			r := result{Seq: msg, Duration: dur}
+			if err != nil {
+				r.Error = err.Error()
 			}
+			_ = enc.Encode(r)
+		} else if err != nil {
+			fmt.Printf("%d fail in %s: %v\n", msg, dur, err)
 		} else {
-			_ = c.Close()
-			fmt.Println(dur)
+			fmt.Println(msg, dur)
+		}
+
+		if err != nil && !*keepOn {
+			if nErr, ok := err.(net.Error); !ok || !nErr.Temporary() {
+				failed = true
+				break
+			}
+		}
+	}
+
+	stats := summary.Stats()
+	if *jsonOut {
+		_ = enc.Encode(report{
+			Target:    target,
+			Stats:     stats,
+			Histogram: summary.Histogram(ping.DefaultBuckets),
+		})
+	} else {
+		printSummary(target, stats, summary.Histogram(ping.DefaultBuckets))
+	}
+
+	if failed || stats.Succeeded == 0 {
+		os.Exit(1)
+	}
+}
+
+// result is the JSON representation of a single ping.
+type result struct {
+	Seq      int           `json:"seq"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// report is the JSON representation of the summary.
+type report struct {
+	Target string `json:"target"`
+	ping.Stats
+	Histogram []ping.Bucket `json:"histogram"`
+}
+
+// printSummary writes ping-style statistics, followed by a histogram of the
+// non-empty buckets.
+func printSummary(target string, s ping.Stats, hist []ping.Bucket) {
+	fmt.Printf("\n--- %s ping statistics ---\n", target)
+	fmt.Printf("%d connections attempted, %d succeeded, %.1f%% loss\n",
+		s.Attempts, s.Succeeded, s.Loss)
+
+	if s.Succeeded == 0 {
+		return
+	}
+
+	fmt.Printf("rtt min/avg/max/stddev = %s/%s/%s/%s\n",
+		s.Min, s.Avg, s.Max, s.StdDev)
+	fmt.Printf("rtt p50/p90/p99 = %s/%s/%s\n", s.P50, s.P90, s.P99)
+
+	for _, b := range hist {
+		if b.Count == 0 {
+			continue
+		}
+
+		label := "<= " + b.Max.String()
+		if b.Max == 0 {
+			label = "> " + hist[len(hist)-2].Max.String()
 		}
 
-		time.Sleep(*interval)
+		fmt.Printf("%10s |%s %d\n", label,
+			strings.Repeat("#", b.Count*40/s.Succeeded), b.Count)
 	}
 }
@@ -0,0 +1,26 @@
+// Package ping measures how long it takes to establish TCP connections.
+package ping
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// TCP dials the TCP address addr, closes the connection, and returns the time
+// it took to establish. It waits no longer than timeout, if positive, or until
+// ctx is done.
+func TCP(ctx context.Context, addr string, timeout time.Duration) (time.Duration, error) {
+	d := net.Dialer{Timeout: timeout}
+
+	start := time.Now()
+	c, err := d.DialContext(ctx, "tcp", addr)
+	dur := time.Since(start)
+
+	if err != nil {
+		return dur, err
+	}
+	_ = c.Close()
+
+	return dur, nil
+}
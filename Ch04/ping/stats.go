@@ -0,0 +1,122 @@
+package ping
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// Summary accumulates the results of pings to a target.
+type Summary struct {
+	attempts  int
+	durations []time.Duration // of successful pings
+}
+
+// Add records the result of a ping.
+func (s *Summary) Add(d time.Duration, err error) {
+	s.attempts++
+
+	if err == nil {
+		s.durations = append(s.durations, d)
+	}
+}
+
+// Stats summarizes the pings. Durations are in nanoseconds when marshaled to
+// JSON.
+type Stats struct {
+	Attempts  int     `json:"attempts"`
+	Succeeded int     `json:"succeeded"`
+	Loss      float64 `json:"loss_percent"` // the percentage of pings that failed
+
+	// The remaining fields describe the successful pings, and are zero if
+	// there were none.
+	Min    time.Duration `json:"min_ns"`
+	Avg    time.Duration `json:"avg_ns"`
+	Max    time.Duration `json:"max_ns"`
+	StdDev time.Duration `json:"stddev_ns"` // population standard deviation
+	P50    time.Duration `json:"p50_ns"`
+	P90    time.Duration `json:"p90_ns"`
+	P99    time.Duration `json:"p99_ns"`
+}
+
+// Stats returns the statistics of the pings so far.
+func (s *Summary) Stats() Stats {
+	stats := Stats{Attempts: s.attempts, Succeeded: len(s.durations)}
+
+	if s.attempts > 0 {
+		stats.Loss = 100 * float64(s.attempts-len(s.durations)) / float64(s.attempts)
+	}
+
+	if len(s.durations) == 0 {
+		return stats
+	}
+
+	sorted := slices.Clone(s.durations)
+	slices.Sort(sorted)
+
+	var sum float64
+	for _, d := range sorted {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(sorted))
+
+	var variance float64
+	for _, d := range sorted {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+	variance /= float64(len(sorted))
+
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	stats.Avg = time.Duration(math.Round(mean))
+	stats.StdDev = time.Duration(math.Round(math.Sqrt(variance)))
+	stats.P50 = Percentile(sorted, 50)
+	stats.P90 = Percentile(sorted, 90)
+	stats.P99 = Percentile(sorted, 99)
+
+	return stats
+}
+
+// DefaultBuckets are histogram bucket upper bounds suited to dial times.
+var DefaultBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second,
+}
+
+// Bucket is a histogram bucket counting the successful pings that took longer
+// than the previous bucket's upper bound and no longer than Max. The last
+// bucket's Max is zero, meaning it has no upper bound.
+type Bucket struct {
+	Max   time.Duration `json:"max_ns,omitempty"`
+	Count int           `json:"count"`
+}
+
+// Histogram returns the successful ping durations counted into buckets
+// with the given ascending upper bounds, plus a final unbounded bucket.
+func (s *Summary) Histogram(bounds []time.Duration) []Bucket {
+	buckets := make([]Bucket, len(bounds)+1)
+	for i, b := range bounds {
+		buckets[i].Max = b
+	}
+
+	for _, d := range s.durations {
+		i, _ := slices.BinarySearch(bounds, d)
+		buckets[i].Count++
+	}
+
+	return buckets
+}
+
+// Percentile returns the pth percentile of sorted durations using the
+// nearest-rank method, or zero if there are none.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
@@ -0,0 +1,74 @@
+package ping
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSummary(t *testing.T) {
+	var s Summary
+
+	if stats := s.Stats(); stats != (Stats{}) {
+		t.Errorf("expected zero stats; actual %+v", stats)
+	}
+
+	for i := 1; i <= 8; i++ {
+		s.Add(time.Duration(i)*time.Millisecond, nil)
+	}
+	s.Add(0, errors.New("refused"))
+	s.Add(time.Second, errors.New("timeout"))
+
+	expected := Stats{
+		Attempts:  10,
+		Succeeded: 8,
+		Loss:      20,
+		Min:       time.Millisecond,
+		Avg:       4500 * time.Microsecond,
+		Max:       8 * time.Millisecond,
+		StdDev:    2291288, // sqrt(5.25) ms
+		P50:       4 * time.Millisecond,
+		P90:       8 * time.Millisecond,
+		P99:       8 * time.Millisecond,
+	}
+
+	if actual := s.Stats(); actual != expected {
+		t.Errorf("expected %+v; actual %+v", expected, actual)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i + 1)
+	}
+
+	for p, expected := range map[float64]time.Duration{
+		0: 1, 1: 1, 50: 50, 90: 90, 99: 99, 99.5: 100, 100: 100,
+	} {
+		if actual := Percentile(sorted, p); actual != expected {
+			t.Errorf("p%v: expected %d; actual %d", p, expected, actual)
+		}
+	}
+
+	if actual := Percentile(nil, 50); actual != 0 {
+		t.Errorf("expected 0 for no durations; actual %d", actual)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var s Summary
+
+	for _, d := range []time.Duration{1, 2, 3, 10, 11, 100} {
+		s.Add(d, nil)
+	}
+	s.Add(5, errors.New("refused"))
+
+	expected := []Bucket{{Max: 2, Count: 2}, {Max: 10, Count: 2}, {Count: 2}}
+
+	actual := s.Histogram([]time.Duration{2, 10})
+	if !slices.Equal(actual, expected) {
+		t.Errorf("expected %v; actual %v", expected, actual)
+	}
+}
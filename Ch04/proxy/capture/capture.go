@@ -0,0 +1,188 @@
+// Package capture records the traffic of proxied connections to a file and
+// replays the client side of a recording against a server.
+//
+// A capture file begins with the 8-byte magic "NPGCAP1\n", followed by a
+// record for each chunk of data the proxy copied. A record has a 1-byte
+// direction, an 8-byte timestamp in nanoseconds since the Unix epoch, a 4-byte
+// length, and the data. Integers are big-endian.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const magic = "NPGCAP1\n"
+
+// MaxRecordSize is the largest record a Reader accepts.
+const MaxRecordSize = 10 << 20 // 10 MB
+
+var ErrInvalidCapture = errors.New("capture: invalid capture file")
+
+// Direction is the direction of a record's data.
+type Direction uint8
+
+const (
+	ClientToServer Direction = '>'
+	ServerToClient Direction = '<'
+)
+
+func (d Direction) String() string {
+	switch d {
+	case ClientToServer:
+		return "client->server"
+	case ServerToClient:
+		return "server->client"
+	default:
+		return fmt.Sprintf("Direction(%d)", uint8(d))
+	}
+}
+
+// Record is a chunk of data sent in one direction.
+type Record struct {
+	Time      time.Time
+	Direction Direction
+	Data      []byte
+}
+
+// Writer writes records to a capture file. It's safe for concurrent use, so
+// both directions of a connection may share it.
+type Writer struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+	c  io.Closer // the underlying writer, if it's an io.Closer
+}
+
+// NewWriter writes the capture file magic to w and returns a Writer for it.
+func NewWriter(w io.Writer) (*Writer, error) {
+	cw := &Writer{w: bufio.NewWriter(w)}
+	cw.c, _ = w.(io.Closer)
+
+	_, err := cw.w.WriteString(magic)
+	if err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+// Write writes a record of data sent in direction d now.
+func (w *Writer) Write(d Direction, data []byte) error {
+	return w.WriteRecord(Record{Time: time.Now(), Direction: d, Data: data})
+}
+
+// WriteRecord writes r.
+func (w *Writer) WriteRecord(r Record) error {
+	var header [13]byte
+	header[0] = byte(r.Direction)
+	binary.BigEndian.PutUint64(header[1:], uint64(r.Time.UnixNano()))
+	binary.BigEndian.PutUint32(header[9:], uint32(len(r.Data)))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := w.w.Write(header[:])
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Write(r.Data)
+
+	return err
+}
+
+// Close flushes buffered records and closes the underlying writer if it's an
+// io.Closer.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.w.Flush()
+
+	if w.c != nil {
+		if cErr := w.c.Close(); err == nil {
+			err = cErr
+		}
+	}
+
+	return err
+}
+
+// Reader reads records from a capture file.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader reads the capture file magic from r and returns a Reader for its
+// records.
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{r: bufio.NewReader(r)}
+
+	b := make([]byte, len(magic))
+
+	_, err := io.ReadFull(cr.r, b)
+	if err != nil || string(b) != magic {
+		return nil, ErrInvalidCapture
+	}
+
+	return cr, nil
+}
+
+// Next returns the next record. It returns io.EOF after the last record.
+func (r *Reader) Next() (Record, error) {
+	var header [13]byte
+
+	_, err := io.ReadFull(r.r, header[:])
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w: truncated record", ErrInvalidCapture)
+		}
+
+		return Record{}, err
+	}
+
+	rec := Record{
+		Direction: Direction(header[0]),
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(header[1:]))),
+	}
+
+	if rec.Direction != ClientToServer && rec.Direction != ServerToClient {
+		return Record{}, fmt.Errorf("%w: direction %#x", ErrInvalidCapture, header[0])
+	}
+
+	size := binary.BigEndian.Uint32(header[9:])
+	if size > MaxRecordSize {
+		return Record{}, fmt.Errorf("%w: %d-byte record", ErrInvalidCapture, size)
+	}
+
+	rec.Data = make([]byte, size)
+
+	_, err = io.ReadFull(r.r, rec.Data)
+	if err != nil {
+		return Record{}, fmt.Errorf("%w: truncated record", ErrInvalidCapture)
+	}
+
+	return rec, nil
+}
+
+// ReadAll returns the remaining records.
+func (r *Reader) ReadAll() ([]Record, error) {
+	var records []Record
+
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+
+		records = append(records, rec)
+	}
+}
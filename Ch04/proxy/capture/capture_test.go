@@ -0,0 +1,75 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriterReader(t *testing.T) {
+	start := time.Unix(1700000000, 123)
+	records := []Record{
+		{Time: start, Direction: ClientToServer, Data: []byte("ping")},
+		{Time: start.Add(time.Millisecond), Direction: ServerToClient, Data: []byte("pong")},
+		{Time: start.Add(2 * time.Millisecond), Direction: ClientToServer, Data: []byte{}},
+	}
+
+	buf := new(bytes.Buffer)
+
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rec := range records {
+		err = w.WriteRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(records, actual) {
+		t.Errorf("expected %v; actual %v", records, actual)
+	}
+
+	_, err = r.Next()
+	if err != io.EOF {
+		t.Errorf("expected io.EOF; actual: %v", err)
+	}
+
+	// A truncated file fails.
+	r, err = NewReader(bytes.NewReader(b[:len(b)-10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.ReadAll()
+	if !errors.Is(err, ErrInvalidCapture) {
+		t.Errorf("expected ErrInvalidCapture; actual: %v", err)
+	}
+
+	_, err = NewReader(bytes.NewReader([]byte("not a capture")))
+	if !errors.Is(err, ErrInvalidCapture) {
+		t.Errorf("expected ErrInvalidCapture; actual: %v", err)
+	}
+}
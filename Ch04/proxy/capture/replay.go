@@ -0,0 +1,168 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Replayer sends the client side of a capture to a server and collects the
+// server's replies for comparison with the captured ones.
+type Replayer struct {
+	// Speed scales the captured delays between records: 1 replays at the
+	// captured pace, and 2 twice as fast. If zero, the Replayer sends each
+	// client record as soon as the server has sent as much data as it had in
+	// the capture by then.
+	Speed float64
+
+	// Timeout is the time to wait for the server's data before sending the
+	// next client record anyway, and for the server to finish after the
+	// last one; 5 seconds if zero.
+	Timeout time.Duration
+}
+
+// Result is the outcome of a replay.
+type Result struct {
+	Sent     int64  // bytes sent to the server
+	Expected []byte // the server's data in the capture
+	Received []byte // the server's data during the replay
+}
+
+// Match reports whether the server sent the same data as in the capture.
+func (r Result) Match() bool { return bytes.Equal(r.Expected, r.Received) }
+
+// Replay sends the client records to conn, half-closes it, and reads from it
+// until the server closes it or stops sending for the Timeout. If ctx is
+// done, Replay stops and returns the context's error.
+func (rp Replayer) Replay(ctx context.Context, conn net.Conn, records []Record) (Result, error) {
+	timeout := rp.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	var (
+		result   Result
+		mu       sync.Mutex
+		received []byte
+		notify   = make(chan struct{}, 1) // signaled when data arrives
+		done     = make(chan error, 1)    // receives the reader's final error
+	)
+
+	go func() {
+		buf := make([]byte, 32*1024)
+
+		for {
+			n, err := conn.Read(buf)
+
+			mu.Lock()
+			received = append(received, buf[:n]...)
+			mu.Unlock()
+
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	// waitFor waits up to the timeout until the server has sent n bytes.
+	waitFor := func(n int) {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		for {
+			mu.Lock()
+			got := len(received)
+			mu.Unlock()
+
+			if got >= n {
+				return
+			}
+
+			select {
+			case <-notify:
+			case <-timer.C:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	var last time.Time // the time of the previous record
+
+	for _, rec := range records {
+		if rp.Speed > 0 && !last.IsZero() {
+			select {
+			case <-time.After(time.Duration(float64(rec.Time.Sub(last)) / rp.Speed)):
+			case <-ctx.Done():
+			}
+		}
+		last = rec.Time
+
+		if rec.Direction == ServerToClient {
+			result.Expected = append(result.Expected, rec.Data...)
+			continue
+		}
+
+		if rp.Speed == 0 {
+			waitFor(len(result.Expected))
+		}
+
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		n, err := conn.Write(rec.Data)
+		result.Sent += int64(n)
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	}
+
+	// Wait for the server to close the connection, or to go quiet.
+	var err error
+
+	for err == nil {
+		if ctx.Err() == nil {
+			_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+
+		select {
+		case err = <-done:
+		case <-notify:
+		}
+	}
+
+	mu.Lock()
+	result.Received = received
+	mu.Unlock()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return result, ctxErr
+	}
+
+	var nErr net.Error
+	if err == io.EOF || (errors.As(err, &nErr) && nErr.Timeout()) {
+		err = nil
+	}
+
+	return result, err
+}
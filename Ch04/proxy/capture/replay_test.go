@@ -0,0 +1,121 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lineServer replies to each line it reads with the result of reply.
+func lineServer(t *testing.T, reply func(string) string) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(c net.Conn) {
+				defer c.Close()
+
+				s := bufio.NewScanner(c)
+				for s.Scan() {
+					_, err := c.Write([]byte(reply(s.Text()) + "\n"))
+					if err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestReplay(t *testing.T) {
+	upper := lineServer(t, strings.ToUpper)
+	lower := lineServer(t, strings.ToLower)
+
+	start := time.Now()
+	records := []Record{
+		{Time: start, Direction: ClientToServer, Data: []byte("Hello\n")},
+		{Time: start.Add(10 * time.Millisecond), Direction: ServerToClient, Data: []byte("HELLO\n")},
+		{Time: start.Add(20 * time.Millisecond), Direction: ClientToServer, Data: []byte("World\n")},
+		{Time: start.Add(30 * time.Millisecond), Direction: ServerToClient, Data: []byte("WO")},
+		{Time: start.Add(31 * time.Millisecond), Direction: ServerToClient, Data: []byte("RLD\n")},
+	}
+
+	for _, test := range []struct {
+		addr  string
+		speed float64
+		match bool
+	}{
+		{upper, 0, true},
+		{upper, 1, true},
+		{upper, 10, true},
+		{lower, 0, false},
+	} {
+		conn, err := net.Dial("tcp", test.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rp := Replayer{Speed: test.speed, Timeout: time.Second}
+
+		result, err := rp.Replay(context.Background(), conn, records)
+		_ = conn.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Sent != 12 {
+			t.Errorf("expected 12 bytes sent; actual %d", result.Sent)
+		}
+
+		if result.Match() != test.match {
+			t.Errorf("speed %v: expected match %t; received %q", test.speed, test.match, result.Received)
+		}
+	}
+}
+
+func TestReplayCancel(t *testing.T) {
+	addr := lineServer(t, strings.ToUpper)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The server never sends the reply the capture expects.
+	records := []Record{
+		{Direction: ServerToClient, Data: []byte("banner\n")},
+		{Direction: ClientToServer, Data: []byte("hi\n")},
+	}
+
+	start := time.Now()
+
+	_, err = Replayer{Timeout: time.Minute}.Replay(ctx, conn, records)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded; actual: %v", err)
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("expected Replay to return promptly; took %s", d)
+	}
+}
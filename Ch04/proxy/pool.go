@@ -0,0 +1,312 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/ping"
+)
+
+// Strategy is how a Pool picks an upstream for each connection.
+type Strategy int
+
+const (
+	RoundRobin       Strategy = iota // each healthy upstream in turn
+	LeastConnections                 // the healthy upstream with the fewest open connections
+	ConsistentHash                   // the same healthy upstream for each client IP
+)
+
+// replicas is the number of points each upstream has on the consistent hash
+// ring. More points spread clients more evenly.
+const replicas = 100
+
+// ErrNoUpstreams is returned when a Pool has no healthy upstreams.
+var ErrNoUpstreams = errors.New("no healthy upstreams")
+
+// Pool balances connections across upstream servers, leaving out upstreams
+// that fail health checks until they pass again.
+type Pool struct {
+	Strategy Strategy
+
+	// CheckInterval is the time between health checks; 10 seconds if zero.
+	CheckInterval time.Duration
+
+	// CheckTimeout is the time an upstream has to accept a health check
+	// connection; 2 seconds if zero.
+	CheckTimeout time.Duration
+
+	// FailAfter is the number of consecutive failed health checks that
+	// remove an upstream; 1 if zero.
+	FailAfter int
+
+	// RecoverAfter is the number of consecutive passed health checks that
+	// return a removed upstream; 1 if zero.
+	RecoverAfter int
+
+	mu        sync.Mutex
+	upstreams []*upstream
+	next      int         // the index of the next upstream for RoundRobin
+	ring      []ringPoint // the ConsistentHash ring, sorted by hash; nil if stale
+}
+
+// upstream is an upstream server in a Pool.
+type upstream struct {
+	addr      string
+	healthy   bool
+	conns     int // open connections
+	fails     int // consecutive failed health checks
+	successes int // consecutive passed health checks
+}
+
+type ringPoint struct {
+	hash     uint32
+	upstream *upstream
+}
+
+// UpstreamStatus describes an upstream in a Pool.
+type UpstreamStatus struct {
+	Addr    string
+	Healthy bool
+	Conns   int // open connections
+}
+
+// Add adds an upstream at addr to the pool, healthy until it fails a health
+// check. Adding an address already in the pool does nothing.
+func (p *Pool) Add(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, u := range p.upstreams {
+		if u.addr == addr {
+			return
+		}
+	}
+
+	p.upstreams = append(p.upstreams, &upstream{addr: addr, healthy: true})
+	p.ring = nil
+}
+
+// Remove removes the upstream at addr from the pool. Open connections to it
+// are unaffected.
+func (p *Pool) Remove(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.upstreams = slices.DeleteFunc(p.upstreams, func(u *upstream) bool {
+		return u.addr == addr
+	})
+	p.ring = nil
+}
+
+// Status returns the status of each upstream in the order they were added.
+func (p *Pool) Status() []UpstreamStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := make([]UpstreamStatus, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		status = append(status, UpstreamStatus{Addr: u.addr, Healthy: u.healthy, Conns: u.conns})
+	}
+
+	return status
+}
+
+// Get returns the address of a healthy upstream for a connection from client,
+// and a function to call once the connection closes.
+func (p *Pool) Get(client net.Addr) (string, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var u *upstream
+
+	switch p.Strategy {
+	case LeastConnections:
+		for _, c := range p.upstreams {
+			if c.healthy && (u == nil || c.conns < u.conns) {
+				u = c
+			}
+		}
+	case ConsistentHash:
+		u = p.lookup(clientIP(client))
+	default:
+		for range p.upstreams {
+			c := p.upstreams[p.next%len(p.upstreams)]
+			p.next++
+
+			if c.healthy {
+				u = c
+				break
+			}
+		}
+	}
+
+	if u == nil {
+		return "", nil, ErrNoUpstreams
+	}
+
+	u.conns++
+
+	var once sync.Once
+
+	done := func() {
+		once.Do(func() {
+			p.mu.Lock()
+			u.conns--
+			p.mu.Unlock()
+		})
+	}
+
+	return u.addr, done, nil
+}
+
+// clientIP returns the IP address of client, or its string form if it has
+// none.
+func clientIP(client net.Addr) string {
+	if tcp, ok := client.(*net.TCPAddr); ok {
+		return tcp.IP.String()
+	}
+
+	host, _, err := net.SplitHostPort(client.String())
+	if err != nil {
+		return client.String()
+	}
+
+	return host
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+
+	return h.Sum32()
+}
+
+// lookup returns the healthy upstream for key on the consistent hash ring, or
+// nil if none are healthy. Only the keys of an upstream that leaves the ring
+// move to other upstreams. The caller must hold p.mu.
+func (p *Pool) lookup(key string) *upstream {
+	if p.ring == nil {
+		for _, u := range p.upstreams {
+			if !u.healthy {
+				continue
+			}
+
+			for i := 0; i < replicas; i++ {
+				p.ring = append(p.ring, ringPoint{
+					hash:     hash(u.addr + "#" + strconv.Itoa(i)),
+					upstream: u,
+				})
+			}
+		}
+
+		slices.SortFunc(p.ring, func(a, b ringPoint) int {
+			return cmp.Compare(a.hash, b.hash)
+		})
+	}
+
+	if len(p.ring) == 0 {
+		return nil
+	}
+
+	h := hash(key)
+
+	i, _ := slices.BinarySearchFunc(p.ring, h, func(pt ringPoint, h uint32) int {
+		return cmp.Compare(pt.hash, h)
+	})
+	if i == len(p.ring) {
+		i = 0 // wrap around the ring
+	}
+
+	return p.ring[i].upstream
+}
+
+// CheckHealth checks the health of each upstream every CheckInterval until
+// ctx is done. An upstream passes a health check if it accepts a TCP
+// connection within CheckTimeout.
+func (p *Pool) CheckHealth(ctx context.Context) {
+	interval := p.CheckInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check checks the health of each upstream concurrently and waits for the
+// results. It records no results if ctx is done.
+func (p *Pool) check(ctx context.Context) {
+	timeout := p.CheckTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	p.mu.Lock()
+	upstreams := slices.Clone(p.upstreams)
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+
+	for _, u := range upstreams {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := ping.TCP(ctx, u.addr, timeout)
+			if ctx.Err() == nil {
+				p.record(u, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// record updates u with the result of a health check.
+func (p *Pool) record(u *upstream, err error) {
+	failAfter, recoverAfter := max(p.FailAfter, 1), max(p.RecoverAfter, 1)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		u.fails++
+		u.successes = 0
+
+		if u.healthy && u.fails >= failAfter {
+			u.healthy = false
+			p.ring = nil
+			log.Printf("upstream %s removed: %v", u.addr, err)
+		}
+
+		return
+	}
+
+	u.successes++
+	u.fails = 0
+
+	if !u.healthy && u.successes >= recoverAfter {
+		u.healthy = true
+		p.ring = nil
+		log.Printf("upstream %s restored", u.addr)
+	}
+}
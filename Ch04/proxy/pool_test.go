@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func tcpAddr(ip string, port int) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+}
+
+func newPool(s Strategy, addrs ...string) *Pool {
+	p := &Pool{Strategy: s}
+	for _, addr := range addrs {
+		p.Add(addr)
+	}
+
+	return p
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	p := newPool(RoundRobin, "a:1", "b:1", "c:1")
+	client := tcpAddr("10.0.0.1", 1234)
+
+	var picked []string
+
+	for i := 0; i < 4; i++ {
+		addr, done, err := p.Get(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done()
+
+		picked = append(picked, addr)
+	}
+
+	if expected := []string{"a:1", "b:1", "c:1", "a:1"}; !slices.Equal(expected, picked) {
+		t.Errorf("expected %v; actual %v", expected, picked)
+	}
+}
+
+func TestPoolLeastConnections(t *testing.T) {
+	p := newPool(LeastConnections, "a:1", "b:1")
+	client := tcpAddr("10.0.0.1", 1234)
+
+	a, doneA, _ := p.Get(client)
+	b, doneB, _ := p.Get(client)
+
+	if a != "a:1" || b != "b:1" {
+		t.Fatalf("expected a:1 then b:1; actual %s then %s", a, b)
+	}
+
+	doneA()
+	doneA() // calling done again has no effect
+
+	addr, _, _ := p.Get(client)
+	if addr != "a:1" {
+		t.Errorf("expected a:1 with fewer connections; actual %s", addr)
+	}
+
+	doneB()
+
+	if s := p.Status(); s[0].Conns != 1 || s[1].Conns != 0 {
+		t.Errorf("unexpected connection counts: %+v", s)
+	}
+}
+
+func TestPoolConsistentHash(t *testing.T) {
+	p := newPool(ConsistentHash, "a:1", "b:1", "c:1")
+
+	pick := func(ip string, port int) string {
+		addr, done, err := p.Get(tcpAddr(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done()
+
+		return addr
+	}
+
+	before := make(map[string]string)
+	counts := make(map[string]int)
+
+	for i := 0; i < 300; i++ {
+		ip := "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)
+		addr := pick(ip, 1000)
+
+		if again := pick(ip, 2000); again != addr {
+			t.Fatalf("%s: expected the same upstream for any port; actual %s and %s", ip, addr, again)
+		}
+
+		before[ip] = addr
+		counts[addr]++
+	}
+
+	if len(counts) != 3 {
+		t.Errorf("expected clients spread across 3 upstreams; actual %v", counts)
+	}
+
+	// Removing an upstream moves only its clients.
+	p.Remove("b:1")
+
+	for ip, addr := range before {
+		if now := pick(ip, 1000); addr != "b:1" && now != addr {
+			t.Errorf("%s: moved from %s to %s", ip, addr, now)
+		}
+	}
+}
+
+func TestPoolHealthChecks(t *testing.T) {
+	up := countServer(t)
+
+	down, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downAddr := down.Addr().String()
+	_ = down.Close()
+
+	p := newPool(RoundRobin, up.Addr().String(), downAddr)
+	p.FailAfter = 2
+	p.CheckTimeout = time.Second
+
+	p.check(context.Background())
+
+	if s := p.Status(); !s[1].Healthy {
+		t.Fatal("expected the upstream to remain until it fails twice")
+	}
+
+	p.check(context.Background())
+
+	if s := p.Status(); !s[0].Healthy || s[1].Healthy {
+		t.Fatalf("expected only the second upstream unhealthy: %+v", s)
+	}
+
+	for i := 0; i < 3; i++ {
+		addr, done, err := p.Get(tcpAddr("10.0.0.1", 1234))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done()
+
+		if addr != up.Addr().String() {
+			t.Errorf("expected the healthy upstream; actual %s", addr)
+		}
+	}
+
+	// The upstream returns once it passes a health check.
+	down, err = net.Listen("tcp", downAddr)
+	if err != nil {
+		t.Skipf("can't listen on %s again: %v", downAddr, err)
+	}
+	defer down.Close()
+
+	p.check(context.Background())
+
+	if s := p.Status(); !s[1].Healthy {
+		t.Errorf("expected the upstream restored: %+v", s)
+	}
+
+	p.Remove(up.Addr().String())
+	p.Remove(downAddr)
+
+	_, _, err = p.Get(tcpAddr("10.0.0.1", 1234))
+	if !errors.Is(err, ErrNoUpstreams) {
+		t.Errorf("expected ErrNoUpstreams; actual: %v", err)
+	}
+}
+
+func TestProxyPool(t *testing.T) {
+	up1, up2 := countServer(t), countServer(t)
+	pool := newPool(RoundRobin, up1.Addr().String(), up2.Addr().String())
+	addr, stats := serve(t, &Proxy{Pool: pool})
+
+	for _, expected := range []net.Listener{up1, up2, up1} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = conn.(*net.TCPConn).CloseWrite()
+		_, _ = io.ReadAll(conn)
+		_ = conn.Close()
+
+		if s := nextStats(t, stats); s.Upstream != expected.Addr().String() {
+			t.Errorf("expected upstream %s; actual %s", expected.Addr(), s.Upstream)
+		}
+	}
+
+	for _, s := range pool.Status() {
+		if s.Conns != 0 {
+			t.Errorf("%s: expected no open connections; actual %d", s.Addr, s.Conns)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+// Package proxy implements a TCP proxy that forwards the connections it
+// accepts to upstream servers.
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/proxy/capture"
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/proxy/proxyproto"
+)
+
+// Proxy forwards each connection it accepts to an upstream server and copies
+// data in both directions until both sides finish sending.
+type Proxy struct {
+	// Upstreams are the addresses of the upstream servers. The proxy dials
+	// them in order and forwards the connection to the first that accepts.
+	Upstreams []string
+
+	// Pool, if set, picks the upstream for each connection instead of
+	// Upstreams.
+	Pool *Pool
+
+	// ProxyProtocol, if 1 or 2, is the version of the PROXY protocol header
+	// the proxy sends each upstream to tell it the client's address.
+	ProxyProtocol int
+
+	DialTimeout time.Duration // the time to wait for an upstream to accept; no limit if zero
+	IdleTimeout time.Duration // closes connections idle in both directions this long; no limit if zero
+
+	// Capture, if set, returns a Writer to record the traffic of the
+	// connection from client. The proxy closes it when the connection closes.
+	Capture func(client net.Addr) (*capture.Writer, error)
+
+	// Report, if set, receives the statistics of each connection when it
+	// closes. Otherwise, the proxy logs them.
+	Report func(Stats)
+}
+
+// Stats describes a proxied connection.
+type Stats struct {
+	Client   string        // the client's address
+	Upstream string        // the upstream's address; empty if none accepted
+	Sent     int64         // bytes from the client to the upstream
+	Received int64         // bytes from the upstream to the client
+	Duration time.Duration // time from accepting the connection until it closed
+	Err      error         // the first error in either direction, if any
+}
+
+// ErrIdleTimeout is reported when a connection exceeds the proxy's
+// IdleTimeout.
+var ErrIdleTimeout = errors.New("idle timeout")
+
+// ListenAndServe listens on the TCP address addr and serves connections.
+func (p *Proxy) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = l.Close() }()
+
+	log.Printf("Listening on %s ...\n", l.Addr())
+
+	return p.Serve(l)
+}
+
+// Serve accepts connections on l and proxies each in its own goroutine. It
+// returns when Accept fails, such as when l is closed.
+func (p *Proxy) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			stats := p.handle(conn)
+
+			if p.Report != nil {
+				p.Report(stats)
+				return
+			}
+
+			if stats.Err != nil {
+				log.Printf("[%s] -> %s: sent %d bytes, received %d bytes in %s: %v",
+					stats.Client, stats.Upstream, stats.Sent, stats.Received,
+					stats.Duration, stats.Err)
+				return
+			}
+
+			log.Printf("[%s] -> %s: sent %d bytes, received %d bytes in %s",
+				stats.Client, stats.Upstream, stats.Sent, stats.Received,
+				stats.Duration)
+		}()
+	}
+}
+
+// handle proxies conn to an upstream and closes it when done.
+func (p *Proxy) handle(conn net.Conn) Stats {
+	defer func() { _ = conn.Close() }()
+
+	stats := Stats{Client: conn.RemoteAddr().String()}
+	start := time.Now()
+
+	upstream, done, err := p.dial(conn.RemoteAddr())
+	if err != nil {
+		stats.Err = err
+		stats.Duration = time.Since(start)
+
+		return stats
+	}
+	defer func() {
+		_ = upstream.Close()
+		done()
+	}()
+
+	stats.Upstream = upstream.RemoteAddr().String()
+
+	if p.ProxyProtocol != 0 {
+		src, _ := conn.RemoteAddr().(*net.TCPAddr)
+		dst, _ := conn.LocalAddr().(*net.TCPAddr)
+		h := proxyproto.Header{Version: p.ProxyProtocol, Source: src, Destination: dst}
+
+		_, err = h.WriteTo(upstream)
+		if err != nil {
+			stats.Err = err
+			stats.Duration = time.Since(start)
+
+			return stats
+		}
+	}
+
+	var cw *capture.Writer
+
+	if p.Capture != nil {
+		cw, err = p.Capture(conn.RemoteAddr())
+		if err != nil {
+			stats.Err = fmt.Errorf("capture: %w", err)
+			stats.Duration = time.Since(start)
+
+			return stats
+		}
+	}
+
+	stats.Sent, stats.Received, stats.Err = p.proxy(conn, upstream, cw)
+
+	if cw != nil {
+		err = cw.Close()
+		if err != nil && stats.Err == nil {
+			stats.Err = fmt.Errorf("capture: %w", err)
+		}
+	}
+
+	stats.Duration = time.Since(start)
+
+	return stats
+}
+
+// dial connects to the upstream the pool picks for client, or if there's no
+// pool, to the first upstream that accepts. It returns a function to call
+// once the connection closes.
+func (p *Proxy) dial(client net.Addr) (net.Conn, func(), error) {
+	if p.Pool != nil {
+		addr, done, err := p.Pool.Get(client)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		conn, err := net.DialTimeout("tcp", addr, p.DialTimeout)
+		if err != nil {
+			done()
+			return nil, nil, err
+		}
+
+		return conn, done, nil
+	}
+
+	if len(p.Upstreams) == 0 {
+		return nil, nil, errors.New("no upstreams")
+	}
+
+	var errs []error
+
+	for _, addr := range p.Upstreams {
+		conn, err := net.DialTimeout("tcp", addr, p.DialTimeout)
+		if err == nil {
+			return conn, func() {}, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return nil, nil, fmt.Errorf("dialing upstreams: %w", errors.Join(errs...))
+}
+
+// proxy copies data between client and upstream until both directions end,
+// or until either fails or the connection is idle too long, recording it to
+// cw if not nil. It returns the bytes copied each way and the first error.
+func (p *Proxy) proxy(client, upstream net.Conn, cw *capture.Writer) (sent, received int64, err error) {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		activity atomic.Int64 // Unix nanoseconds of the last data in either direction
+	)
+
+	activity.Store(time.Now().UnixNano())
+
+	// fail records the first error and closes both connections to stop the
+	// other direction.
+	fail := func(e error) {
+		once.Do(func() {
+			err = e
+			_ = client.Close()
+			_ = upstream.Close()
+		})
+	}
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		var e error
+
+		received, e = p.pipe(client, upstream, &activity, p.recorder(cw, capture.ServerToClient))
+		if e != nil {
+			fail(e)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		var e error
+
+		sent, e = p.pipe(upstream, client, &activity, p.recorder(cw, capture.ClientToServer))
+		if e != nil {
+			fail(e)
+		}
+	}()
+
+	wg.Wait()
+
+	return sent, received, err
+}
+
+// closeWriter is implemented by connections that can half-close, such as
+// *net.TCPConn.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// recorder returns a function that records data sent in direction d to cw,
+// or nil if cw is nil.
+func (p *Proxy) recorder(cw *capture.Writer, d capture.Direction) func([]byte) error {
+	if cw == nil {
+		return nil
+	}
+
+	return func(data []byte) error { return cw.Write(d, data) }
+}
+
+// pipe copies data from src to dst until src reaches EOF, then half-closes
+// dst so its peer sees EOF too but can keep sending. It passes the data to
+// record, if not nil, before writing it to dst. It returns the number of
+// bytes copied.
+func (p *Proxy) pipe(dst, src net.Conn, activity *atomic.Int64, record func([]byte) error) (int64, error) {
+	var (
+		buf = make([]byte, 32*1024)
+		n   int64
+	)
+
+	for {
+		if p.IdleTimeout > 0 {
+			_ = src.SetReadDeadline(time.Now().Add(p.IdleTimeout))
+		}
+
+		nr, err := src.Read(buf)
+		if nr > 0 {
+			now := time.Now()
+			activity.Store(now.UnixNano())
+
+			if p.IdleTimeout > 0 {
+				_ = dst.SetWriteDeadline(now.Add(p.IdleTimeout))
+			}
+
+			if record != nil {
+				rErr := record(buf[:nr])
+				if rErr != nil {
+					return n, fmt.Errorf("capture: %w", rErr)
+				}
+			}
+
+			nw, wErr := dst.Write(buf[:nr])
+			n += int64(nw)
+
+			if wErr != nil {
+				return n, wErr
+			}
+		}
+
+		switch {
+		case err == nil:
+		case err == io.EOF:
+			if cw, ok := dst.(closeWriter); ok {
+				return n, cw.CloseWrite()
+			}
+
+			return n, dst.Close()
+		case isTimeout(err):
+			// The connection is idle only if the other direction is too.
+			last := time.Unix(0, activity.Load())
+			if time.Since(last) < p.IdleTimeout {
+				continue
+			}
+
+			return n, ErrIdleTimeout
+		default:
+			return n, err
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	nErr, ok := err.(net.Error)
+
+	return ok && nErr.Timeout()
+}
@@ -0,0 +1,92 @@
+// The proxy command forwards TCP connections to upstream servers.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/proxy"
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/proxy/capture"
+)
+
+var (
+	address     = flag.String("l", "127.0.0.1:8080", "listen address")
+	dialTimeout = flag.Duration("d", 5*time.Second, "time to wait for an upstream to accept")
+	idleTimeout = flag.Duration("idle", 5*time.Minute, "close connections idle this long; 0 means never")
+	strategy    = flag.String("s", "failover", "upstream strategy: failover, roundrobin, leastconn or hash")
+	interval    = flag.Duration("check", 10*time.Second, "interval between upstream health checks")
+	proxyProto  = flag.Int("proxyproto", 0, "PROXY protocol header version to send upstreams: 1 or 2; 0 for none")
+	captureDir  = flag.String("capture", "", "directory to record each connection's traffic in, for the replay command")
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: %s [options] upstream [upstream ...]\nOptions:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Print("at least one upstream host:port is required\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	p := proxy.Proxy{
+		Upstreams:     flag.Args(),
+		DialTimeout:   *dialTimeout,
+		IdleTimeout:   *idleTimeout,
+		ProxyProtocol: *proxyProto,
+	}
+
+	if *strategy != "failover" {
+		pool := &proxy.Pool{CheckInterval: *interval}
+
+		switch *strategy {
+		case "roundrobin":
+			pool.Strategy = proxy.RoundRobin
+		case "leastconn":
+			pool.Strategy = proxy.LeastConnections
+		case "hash":
+			pool.Strategy = proxy.ConsistentHash
+		default:
+			fmt.Printf("unknown strategy %q\n\n", *strategy)
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		for _, addr := range flag.Args() {
+			pool.Add(addr)
+		}
+
+		go pool.CheckHealth(context.Background())
+
+		p.Pool = pool
+	}
+
+	if *captureDir != "" {
+		p.Capture = func(client net.Addr) (*capture.Writer, error) {
+			name := fmt.Sprintf("%s-%s.cap", time.Now().Format("20060102T150405.000000000"),
+				strings.ReplaceAll(client.String(), ":", "_"))
+
+			f, err := os.Create(filepath.Join(*captureDir, name))
+			if err != nil {
+				return nil, err
+			}
+
+			return capture.NewWriter(f)
+		}
+	}
+
+	log.Fatal(p.ListenAndServe(*address))
+}
@@ -0,0 +1,346 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/proxy/capture"
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/proxy/proxyproto"
+)
+
+// countServer replies to each connection with the number of bytes it read
+// before the client half-closed the connection.
+func countServer(t *testing.T) net.Listener {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(c net.Conn) {
+				defer c.Close()
+
+				n, err := io.Copy(io.Discard, c)
+				if err != nil {
+					return
+				}
+
+				_, _ = c.Write([]byte(strconv.FormatInt(n, 10)))
+			}(conn)
+		}
+	}()
+
+	return l
+}
+
+// serve serves p on a local address and returns the address and a channel
+// receiving the stats of each connection.
+func serve(t *testing.T, p *Proxy) (string, <-chan Stats) {
+	t.Helper()
+
+	stats := make(chan Stats, 10)
+	p.Report = func(s Stats) { stats <- s }
+
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() { _ = p.Serve(l) }()
+
+	return l.Addr().String(), stats
+}
+
+func nextStats(t *testing.T, stats <-chan Stats) Stats {
+	t.Helper()
+
+	select {
+	case s := <-stats:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for connection stats")
+	}
+
+	return Stats{}
+}
+
+func TestProxyHalfClose(t *testing.T) {
+	t.Parallel()
+
+	// A closed listener's address makes an upstream that refuses
+	// connections.
+	down, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = down.Close()
+
+	up := countServer(t)
+	addr, stats := serve(t, &Proxy{
+		Upstreams: []string{down.Addr().String(), up.Addr().String()},
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msg := make([]byte, 100_000)
+
+	_, err = conn.Write(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The upstream replies only after it sees EOF, so this works only if the
+	// proxy propagates the half-close.
+	err = conn.(*net.TCPConn).CloseWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := strconv.Itoa(len(msg)); string(reply) != expected {
+		t.Errorf("expected reply %q; actual %q", expected, reply)
+	}
+
+	s := nextStats(t, stats)
+
+	if s.Err != nil {
+		t.Errorf("unexpected error: %v", s.Err)
+	}
+
+	if s.Upstream != up.Addr().String() {
+		t.Errorf("expected upstream %s; actual %s", up.Addr(), s.Upstream)
+	}
+
+	if s.Sent != int64(len(msg)) || s.Received != int64(len(reply)) {
+		t.Errorf("expected %d bytes sent and %d received; actual %d and %d",
+			len(msg), len(reply), s.Sent, s.Received)
+	}
+
+	if s.Client != conn.LocalAddr().String() {
+		t.Errorf("expected client %s; actual %s", conn.LocalAddr(), s.Client)
+	}
+}
+
+func TestProxyIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	up := countServer(t)
+	addr, stats := serve(t, &Proxy{
+		Upstreams:   []string{up.Addr().String()},
+		IdleTimeout: 200 * time.Millisecond,
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Activity within the timeout keeps the connection open.
+	for i := 0; i < 4; i++ {
+		_, err = conn.Write([]byte("still here"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Errorf("expected the proxy to close the idle connection; actual: %v", err)
+	}
+
+	s := nextStats(t, stats)
+
+	if !errors.Is(s.Err, ErrIdleTimeout) {
+		t.Errorf("expected ErrIdleTimeout; actual: %v", s.Err)
+	}
+
+	if s.Sent != 40 {
+		t.Errorf("expected 40 bytes sent; actual %d", s.Sent)
+	}
+
+	// The last write was at 300ms.
+	if s.Duration < 500*time.Millisecond {
+		t.Errorf("expected the connection to last at least 500ms; actual %s", s.Duration)
+	}
+}
+
+func TestProxyNoUpstream(t *testing.T) {
+	t.Parallel()
+
+	down, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = down.Close()
+
+	addr, stats := serve(t, &Proxy{Upstreams: []string{down.Addr().String()}})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Errorf("expected the proxy to close the connection; actual: %v", err)
+	}
+
+	if s := nextStats(t, stats); s.Err == nil || s.Upstream != "" {
+		t.Errorf("expected a dial error; actual: %+v", s)
+	}
+}
+
+func TestProxyProtocol(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up := &proxyproto.Listener{Listener: l}
+	defer func() { _ = up.Close() }()
+
+	remote := make(chan string, 1)
+
+	go func() {
+		conn, err := up.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		remote <- conn.RemoteAddr().String()
+	}()
+
+	addr, stats := serve(t, &Proxy{Upstreams: []string{l.Addr().String()}, ProxyProtocol: 2})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case actual := <-remote:
+		if expected := conn.LocalAddr().String(); actual != expected {
+			t.Errorf("expected the upstream to see %s; actual %s", expected, actual)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the upstream")
+	}
+
+	_ = conn.Close()
+
+	nextStats(t, stats)
+}
+
+func TestProxyCapture(t *testing.T) {
+	t.Parallel()
+
+	up := countServer(t)
+	buf := new(bytes.Buffer)
+
+	addr, stats := serve(t, &Proxy{
+		Upstreams: []string{up.Addr().String()},
+		Capture: func(net.Addr) (*capture.Writer, error) {
+			return capture.NewWriter(buf)
+		},
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("twelve bytes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.(*net.TCPConn).CloseWrite()
+
+	_, err = io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nextStats(t, stats)
+
+	r, err := capture.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent, received string
+
+	for _, rec := range records {
+		switch rec.Direction {
+		case capture.ClientToServer:
+			sent += string(rec.Data)
+		case capture.ServerToClient:
+			received += string(rec.Data)
+		}
+	}
+
+	if sent != "twelve bytes" || received != "12" {
+		t.Errorf("expected %q sent and %q received; actual %q and %q",
+			"twelve bytes", "12", sent, received)
+	}
+
+	// Replaying the capture against the upstream gets the same reply.
+	conn2, err := net.Dial("tcp", up.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+
+	result, err := capture.Replayer{}.Replay(context.Background(), conn2, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Match() {
+		t.Errorf("expected the replay to match; received %q", result.Received)
+	}
+}
@@ -0,0 +1,283 @@
+// Package proxyproto implements version 1 and 2 of the PROXY protocol, which
+// proxies use to tell upstream servers the addresses of the connections they
+// forward: https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// signature begins every version 2 header.
+var signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	v1Prefix    = "PROXY "
+	v1MaxLength = 107 // the longest version 1 header, including the CRLF
+
+	v2Local = 0x20 // version 2, LOCAL command
+	v2Proxy = 0x21 // version 2, PROXY command
+
+	v2Unspec = 0x00 // unspecified address family and protocol
+	v2TCP4   = 0x11
+	v2TCP6   = 0x21
+)
+
+var (
+	ErrNoHeader      = errors.New("proxyproto: no PROXY protocol header")
+	ErrInvalidHeader = errors.New("proxyproto: invalid PROXY protocol header")
+)
+
+// Header is a PROXY protocol header.
+type Header struct {
+	Version int // 1 or 2
+
+	// Source and Destination are the addresses of the client and of the
+	// proxy's listener. If either is nil or not a *net.TCPAddr, the header
+	// says the addresses are unknown, and the receiver should use the
+	// connection's own addresses.
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// MarshalBinary returns the header in its wire format.
+func (h Header) MarshalBinary() ([]byte, error) {
+	switch h.Version {
+	case 1:
+		return h.marshalV1(), nil
+	case 2:
+		return h.marshalV2(), nil
+	default:
+		return nil, fmt.Errorf("proxyproto: unsupported version %d", h.Version)
+	}
+}
+
+// WriteTo writes the header to w.
+func (h Header) WriteTo(w io.Writer) (int64, error) {
+	b, err := h.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(b)
+
+	return int64(n), err
+}
+
+// known reports whether the header has both addresses, and whether they're
+// IPv4 addresses.
+func (h Header) known() (ok, ipv4 bool) {
+	if h.Source == nil || h.Destination == nil {
+		return false, false
+	}
+
+	src4, dst4 := h.Source.IP.To4() != nil, h.Destination.IP.To4() != nil
+	if src4 != dst4 {
+		return false, false // the families must match
+	}
+
+	return true, src4
+}
+
+func (h Header) marshalV1() []byte {
+	ok, ipv4 := h.known()
+	if !ok {
+		return []byte(v1Prefix + "UNKNOWN\r\n")
+	}
+
+	proto := "TCP6"
+	if ipv4 {
+		proto = "TCP4"
+	}
+
+	return fmt.Appendf(nil, "%s%s %s %s %d %d\r\n", v1Prefix, proto,
+		h.Source.IP, h.Destination.IP, h.Source.Port, h.Destination.Port)
+}
+
+func (h Header) marshalV2() []byte {
+	b := bytes.NewBuffer(append([]byte(nil), signature...))
+
+	ok, ipv4 := h.known()
+	if !ok {
+		b.Write([]byte{v2Local, v2Unspec, 0, 0})
+		return b.Bytes()
+	}
+
+	var (
+		family   byte = v2TCP6
+		src, dst      = h.Source.IP.To16(), h.Destination.IP.To16()
+		length   uint16
+	)
+
+	if ipv4 {
+		family, src, dst = v2TCP4, h.Source.IP.To4(), h.Destination.IP.To4()
+	}
+	length = uint16(2*len(src) + 4)
+
+	b.Write([]byte{v2Proxy, family})
+	_ = binary.Write(b, binary.BigEndian, length)
+	b.Write(src)
+	b.Write(dst)
+	_ = binary.Write(b, binary.BigEndian, uint16(h.Source.Port))
+	_ = binary.Write(b, binary.BigEndian, uint16(h.Destination.Port))
+
+	return b.Bytes()
+}
+
+// ReadHeader reads a version 1 or 2 header from r. It returns ErrNoHeader,
+// having read nothing, if r doesn't begin with a header. It decides as soon as
+// the bytes available can't begin a header, so a client that sends a short
+// message and waits for a reply gets ErrNoHeader rather than a timeout.
+func ReadHeader(r *bufio.Reader) (Header, error) {
+	for n := 1; ; n = r.Buffered() + 1 {
+		b, err := r.Peek(n)
+		if err != nil {
+			if err == io.EOF && len(b) > 0 {
+				err = ErrNoHeader
+			}
+
+			return Header{}, err
+		}
+
+		b, _ = r.Peek(r.Buffered())
+
+		switch v1, v2 := matches(b, v1Prefix), matches(b, string(signature)); {
+		case v1 && len(b) >= len(v1Prefix):
+			return readV1(r)
+		case v2 && len(b) >= len(signature):
+			return readV2(r)
+		case !v1 && !v2:
+			return Header{}, ErrNoHeader
+		}
+	}
+}
+
+// matches reports whether b and prefix agree on their common length, meaning
+// b may begin with prefix.
+func matches(b []byte, prefix string) bool {
+	n := min(len(b), len(prefix))
+
+	return string(b[:n]) == prefix[:n]
+}
+
+func readV1(r *bufio.Reader) (Header, error) {
+	var line []byte
+
+	for len(line) < v1MaxLength {
+		c, err := r.ReadByte()
+		if err != nil {
+			return Header{}, err
+		}
+
+		line = append(line, c)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return Header{}, fmt.Errorf("%w: line too long", ErrInvalidHeader)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	h := Header{Version: 1}
+
+	switch {
+	case len(fields) >= 2 && fields[1] == "UNKNOWN":
+		return h, nil // the receiver ignores anything after UNKNOWN
+	case len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6"):
+		return h, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+
+	var err error
+
+	h.Source, err = parseAddr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return h, err
+	}
+
+	h.Destination, err = parseAddr(fields[3], fields[5], fields[1] == "TCP4")
+
+	return h, err
+}
+
+func parseAddr(ip, port string, ipv4 bool) (*net.TCPAddr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil || (addr.IP.To4() != nil) != ipv4 {
+		return nil, fmt.Errorf("%w: invalid address %q", ErrInvalidHeader, ip)
+	}
+	if ipv4 {
+		addr.IP = addr.IP.To4()
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid port %q", ErrInvalidHeader, port)
+	}
+	addr.Port = int(p)
+
+	return addr, nil
+}
+
+func readV2(r *bufio.Reader) (Header, error) {
+	b := make([]byte, len(signature)+4)
+
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return Header{}, err
+	}
+
+	verCmd, family := b[len(signature)], b[len(signature)+1]
+	length := binary.BigEndian.Uint16(b[len(signature)+2:])
+
+	body := make([]byte, length)
+
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return Header{}, err
+	}
+
+	h := Header{Version: 2}
+
+	switch verCmd {
+	case v2Local:
+		return h, nil // health checks and the like from the proxy itself
+	case v2Proxy:
+	default:
+		return h, fmt.Errorf("%w: version and command %#x", ErrInvalidHeader, verCmd)
+	}
+
+	var size int // the size of each IP address
+
+	switch family {
+	case v2TCP4:
+		size = net.IPv4len
+	case v2TCP6:
+		size = net.IPv6len
+	default:
+		return h, nil // unsupported families leave the addresses unknown
+	}
+
+	// Anything after the addresses is TLVs, which we ignore.
+	if len(body) < 2*size+4 {
+		return h, fmt.Errorf("%w: short address block", ErrInvalidHeader)
+	}
+
+	h.Source = &net.TCPAddr{
+		IP:   net.IP(body[:size]),
+		Port: int(binary.BigEndian.Uint16(body[2*size:])),
+	}
+	h.Destination = &net.TCPAddr{
+		IP:   net.IP(body[size : 2*size]),
+		Port: int(binary.BigEndian.Uint16(body[2*size+2:])),
+	}
+
+	return h, nil
+}
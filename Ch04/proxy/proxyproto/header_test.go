@@ -0,0 +1,91 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	v4src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 56324}
+	v4dst := &net.TCPAddr{IP: net.ParseIP("198.51.100.7").To4(), Port: 443}
+	v6src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324}
+	v6dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}
+
+	for i, h := range []Header{
+		{Version: 1, Source: v4src, Destination: v4dst},
+		{Version: 1, Source: v6src, Destination: v6dst},
+		{Version: 1},
+		{Version: 2, Source: v4src, Destination: v4dst},
+		{Version: 2, Source: v6src, Destination: v6dst},
+		{Version: 2},
+	} {
+		b, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		// The data after the header must remain unread.
+		r := bufio.NewReader(bytes.NewReader(append(b, "GET / HTTP/1.1"...)))
+
+		actual, err := ReadHeader(r)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(h, actual) {
+			t.Errorf("%d: expected %+v; actual %+v", i, h, actual)
+		}
+
+		rest, _ := r.ReadString('\n')
+		if rest != "GET / HTTP/1.1" {
+			t.Errorf("%d: expected the rest of the stream; actual %q", i, rest)
+		}
+	}
+
+	b, _ := Header{Version: 1, Source: v4src, Destination: v4dst}.MarshalBinary()
+	if expected := "PROXY TCP4 192.0.2.1 198.51.100.7 56324 443\r\n"; string(b) != expected {
+		t.Errorf("expected %q; actual %q", expected, b)
+	}
+
+	b, _ = Header{Version: 2, Source: v4src, Destination: v4dst}.MarshalBinary()
+	expected := append([]byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c"),
+		192, 0, 2, 1, 198, 51, 100, 7, 0xdc, 0x04, 0x01, 0xbb)
+	if !bytes.Equal(expected, b) {
+		t.Errorf("expected %x; actual %x", expected, b)
+	}
+}
+
+func TestReadHeaderInvalid(t *testing.T) {
+	for _, s := range []string{
+		"PROXY TCP4 192.0.2.1 198.51.100.7 56324\r\n",
+		"PROXY TCP4 2001:db8::1 198.51.100.7 56324 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.7 56324 65536\r\n",
+		"PROXY UDP4 192.0.2.1 198.51.100.7 56324 443\r\n",
+		"PROXY " + strings.Repeat("X", 200) + "\r\n",
+		"\r\n\r\n\x00\r\nQUIT\n\x31\x11\x00\x00",
+		"\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x04\x00\x00\x00\x00",
+	} {
+		_, err := ReadHeader(bufio.NewReader(strings.NewReader(s)))
+		if !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("%q: expected ErrInvalidHeader; actual: %v", s, err)
+		}
+	}
+
+	for _, s := range []string{"GET / HTTP/1.1\r\n", "hi", "\r\n\r\n\x00\r\nQUIZ\n"} {
+		r := bufio.NewReader(strings.NewReader(s))
+
+		_, err := ReadHeader(r)
+		if err != ErrNoHeader {
+			t.Errorf("%q: expected ErrNoHeader; actual: %v", s, err)
+		}
+
+		if r.Buffered() != len(s) {
+			t.Errorf("%q: expected ReadHeader to leave the data unread", s)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package proxyproto
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Listener wraps a net.Listener whose connections begin with a PROXY protocol
+// header, such as one behind a proxy. The connections it accepts report the
+// addresses in the header from RemoteAddr and LocalAddr.
+type Listener struct {
+	net.Listener
+
+	// Optional accepts connections without a header, which report their own
+	// addresses. Otherwise, reading from them fails with ErrNoHeader. A
+	// connection that doesn't complete a header within ReadHeaderTimeout is
+	// treated as having none.
+	Optional bool
+
+	// ReadHeaderTimeout is the time a connection has to send its header; 10
+	// seconds if zero.
+	ReadHeaderTimeout time.Duration
+}
+
+// Accept returns the next connection. The connection reads the header on the
+// first call to its Read, RemoteAddr or LocalAddr method, so a slow client
+// doesn't hold up Accept.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := l.ReadHeaderTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	c := &Conn{
+		Conn:     conn,
+		r:        bufio.NewReader(conn),
+		optional: l.Optional,
+		timeout:  timeout,
+	}
+
+	return c, nil
+}
+
+// Conn is a connection accepted by a Listener.
+type Conn struct {
+	net.Conn
+
+	r        *bufio.Reader
+	optional bool
+	timeout  time.Duration
+
+	once   sync.Once
+	header *Header // nil if the connection had no header
+	err    error
+
+	mu           sync.Mutex
+	readDeadline time.Time // the caller's, restored after reading the header
+}
+
+// readHeader reads the header once.
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		c.mu.Lock()
+		deadline := time.Now().Add(c.timeout)
+		if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+			deadline = c.readDeadline
+		}
+		_ = c.Conn.SetReadDeadline(deadline)
+		c.mu.Unlock()
+
+		defer func() {
+			c.mu.Lock()
+			_ = c.Conn.SetReadDeadline(c.readDeadline)
+			c.mu.Unlock()
+		}()
+
+		h, err := ReadHeader(c.r)
+		switch {
+		case err == nil:
+			c.header = &h
+		case c.optional && (err == ErrNoHeader || os.IsTimeout(err)):
+			// Anything read remains buffered for Read.
+		default:
+			c.err = err
+		}
+	})
+}
+
+// SetDeadline sets the read and write deadlines. The read deadline also
+// applies to reading the header if it's earlier than ReadHeaderTimeout.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDeadline = t
+
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline. It also applies to reading the
+// header if it's earlier than ReadHeaderTimeout.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDeadline = t
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+// Header returns the connection's PROXY protocol header, or nil if it had
+// none.
+func (c *Conn) Header() (*Header, error) {
+	c.readHeader()
+
+	return c.header, c.err
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.r.Read(p)
+}
+
+// RemoteAddr returns the client's address from the header, if known, or the
+// connection's remote address.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the proxy's listening address from the header, if known,
+// or the connection's local address.
+func (c *Conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.Destination != nil {
+		return c.header.Destination
+	}
+
+	return c.Conn.LocalAddr()
+}
@@ -0,0 +1,253 @@
+package proxyproto
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListenerHTTP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, r.RemoteAddr)
+		}),
+		ReadHeaderTimeout: time.Second,
+	}
+
+	go func() { _ = srv.Serve(&Listener{Listener: l, Optional: true}) }()
+	defer func() { _ = srv.Close() }()
+
+	get := func(header string) string {
+		t.Helper()
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, err = io.WriteString(conn, header+
+			"GET / HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(b)
+	}
+
+	if actual := get("PROXY TCP4 192.0.2.1 127.0.0.1 56324 80\r\n"); actual != "192.0.2.1:56324" {
+		t.Errorf("expected the client address from the v1 header; actual %s", actual)
+	}
+
+	h, _ := Header{
+		Version:     2,
+		Source:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234},
+		Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 80},
+	}.MarshalBinary()
+
+	if actual := get(string(h)); actual != "[2001:db8::1]:1234" {
+		t.Errorf("expected the client address from the v2 header; actual %s", actual)
+	}
+
+	// Without a header, the optional listener reports the real address.
+	if actual := get(""); !strings.HasPrefix(actual, "127.0.0.1:") {
+		t.Errorf("expected the connection's address; actual %s", actual)
+	}
+}
+
+func TestListenerRequired(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pl := &Listener{Listener: l, ReadHeaderTimeout: 100 * time.Millisecond}
+	defer func() { _ = pl.Close() }()
+
+	errs := make(chan error, 2)
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := pl.Accept()
+			if err != nil {
+				return
+			}
+
+			_, err = conn.Read(make([]byte, 1))
+			errs <- err
+			_ = conn.Close()
+		}
+	}()
+
+	// A connection without a header fails.
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	_, _ = io.WriteString(conn, "GET / HTTP/1.1\r\n")
+
+	if err = <-errs; err != ErrNoHeader {
+		t.Errorf("expected ErrNoHeader; actual: %v", err)
+	}
+
+	// So does one that doesn't send its header in time.
+	conn2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn2.Close() }()
+
+	select {
+	case err = <-errs:
+		if nErr, ok := err.(net.Error); !ok || !nErr.Timeout() {
+			t.Errorf("expected a timeout; actual: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the header to time out")
+	}
+}
+
+// echo serves a Listener with Optional set, echoing what each connection
+// reads.
+func echo(t *testing.T, timeout time.Duration) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	pl := &Listener{Listener: l, Optional: true, ReadHeaderTimeout: timeout}
+
+	go func() {
+		for {
+			conn, err := pl.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestListenerOptionalShortMessage(t *testing.T) {
+	addr := echo(t, 500*time.Millisecond)
+
+	for _, c := range []struct {
+		msg string
+		max time.Duration // until the echo
+	}{
+		{"hi\n", 250 * time.Millisecond},            // can't begin a header
+		{"PRO", 250*time.Millisecond + time.Second}, // might; waits out the timeout
+	} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+
+		_, err = io.WriteString(conn, c.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		buf := make([]byte, len(c.msg))
+
+		_, err = io.ReadFull(conn, buf)
+		if err != nil {
+			t.Fatalf("%q: %v", c.msg, err)
+		}
+
+		if string(buf) != c.msg {
+			t.Errorf("expected %q echoed; actual %q", c.msg, buf)
+		}
+
+		if elapsed := time.Since(start); elapsed > c.max {
+			t.Errorf("%q: echoed after %s; expected within %s", c.msg, elapsed, c.max)
+		}
+
+		_ = conn.Close()
+	}
+}
+
+func TestConnKeepsReadDeadline(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+
+	pl := &Listener{Listener: l}
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	_, err = io.WriteString(client, "PROXY TCP4 192.0.2.1 127.0.0.1 56324 80\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// The deadline set before the first Read still applies after the header.
+	err = conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		errs <- err
+	}()
+
+	select {
+	case err = <-errs:
+		if !os.IsTimeout(err) {
+			t.Errorf("expected a timeout; actual %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read ignored the deadline")
+	}
+}
@@ -0,0 +1,83 @@
+// The replay command sends the client side of a connection captured by the
+// proxy command to a server and reports whether the server's replies match
+// the captured ones.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/proxy/capture"
+)
+
+var (
+	speed   = flag.Float64("speed", 0, "replay speed relative to the capture; 0 waits for each reply instead")
+	timeout = flag.Duration("W", 5*time.Second, "time to wait for the server's replies")
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: %s [options] capture-file host:port\nOptions:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Print("a capture file and host:port are required\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r, err := capture.NewReader(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	records, err := r.ReadAll()
+	_ = f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	rp := capture.Replayer{Speed: *speed, Timeout: *timeout}
+
+	result, err := rp.Replay(ctx, conn, records)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("sent %d bytes; received %d bytes, expected %d bytes\n",
+		result.Sent, len(result.Received), len(result.Expected))
+
+	if !result.Match() {
+		fmt.Println("MISMATCH: the server's replies differ from the capture")
+		os.Exit(1)
+	}
+
+	fmt.Println("OK")
+}
@@ -0,0 +1,186 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/payload"
+)
+
+// ErrClientClosed is returned by calls on a closed Client.
+var ErrClientClosed = errors.New("rpc: client closed")
+
+// ServerError is an error the server returned in response to a call.
+type ServerError struct {
+	Method  string
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("rpc: %s: %s", e.Method, e.Message)
+}
+
+// Client makes calls to a server over a single connection. It's safe for
+// concurrent use, and concurrent calls share the connection.
+type Client struct {
+	conn net.Conn
+	wmu  sync.Mutex // serializes requests
+	enc  *payload.Encoder
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan Message // calls awaiting a response
+	err     error                   // set once the connection fails
+	done    chan struct{}           // closed when the client stops reading responses
+}
+
+// Dial connects to the server at address and returns a Client for it.
+func Dial(ctx context.Context, network, address string) (*Client, error) {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(conn), nil
+}
+
+// NewClient returns a Client that makes calls over conn. The Client owns
+// conn and closes it when the Client is closed.
+func NewClient(conn net.Conn) *Client {
+	c := &Client{
+		conn:    conn,
+		enc:     payload.NewEncoder(conn),
+		pending: make(map[uint64]chan Message),
+		done:    make(chan struct{}),
+	}
+
+	go c.read()
+
+	return c
+}
+
+// Call calls method on the server with body, which may be nil, and returns
+// the response body. If ctx is done before the response arrives, Call
+// returns the context's error and discards the response when it arrives.
+func (c *Client) Call(ctx context.Context, method string, body payload.Payload) (payload.Payload, error) {
+	ch := make(chan Message, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	c.wmu.Lock()
+	err := c.enc.Encode(Message{ID: id, Method: method, Body: body}.Payload())
+	c.wmu.Unlock()
+
+	if err != nil {
+		c.forget(id)
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return response(method, resp)
+	case <-c.done:
+		// The response may have arrived just before the connection failed,
+		// leaving both channels ready.
+		select {
+		case resp := <-ch:
+			return response(method, resp)
+		default:
+		}
+
+		c.forget(id)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		return nil, c.err
+	case <-ctx.Done():
+		c.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+// response returns resp's body, or its error as a ServerError.
+func response(method string, resp Message) (payload.Payload, error) {
+	if resp.Error != "" {
+		return nil, &ServerError{Method: method, Message: resp.Error}
+	}
+
+	return resp.Body, nil
+}
+
+// forget stops waiting for the response to call id.
+func (c *Client) forget(id uint64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// Close closes the connection. Calls in progress return ErrClientClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = ErrClientClosed
+	}
+	c.mu.Unlock()
+
+	err := c.conn.Close()
+	<-c.done
+
+	return err
+}
+
+// read delivers each response to the call awaiting it until the connection
+// fails.
+func (c *Client) read() {
+	dec := payload.NewDecoder(c.conn)
+
+	var err error
+
+	for {
+		var p payload.Payload
+
+		p, err = dec.Decode()
+		if err != nil {
+			break
+		}
+
+		var resp Message
+
+		resp, err = parseMessage(p)
+		if err != nil {
+			break
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.mu.Unlock()
+
+		if ok {
+			ch <- resp // buffered, so this never blocks
+		}
+	}
+
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = fmt.Errorf("rpc: reading responses: %w", err)
+	}
+	c.mu.Unlock()
+
+	_ = c.conn.Close()
+	close(c.done)
+}
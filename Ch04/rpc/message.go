@@ -0,0 +1,84 @@
+// Package rpc implements request/response calls over the payload protocol.
+// Clients send requests, and servers reply with responses, in Messages that
+// carry an ID so a client may have many calls in progress on one connection.
+package rpc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/payload"
+)
+
+// Message is the envelope for a request or a response. It travels as a
+// payload.Map.
+type Message struct {
+	ID     uint64          // matches a response to its request
+	Method string          // the method a request calls; empty in responses
+	Body   payload.Payload // the request's argument or the response's result; may be nil
+	Error  string          // if set, the reason a request failed
+}
+
+// Map keys of an encoded Message.
+const (
+	keyID     = "id"
+	keyMethod = "method"
+	keyBody   = "body"
+	keyError  = "error"
+)
+
+// Payload returns the Message as a *payload.Map, omitting empty fields other
+// than the ID.
+func (m Message) Payload() payload.Payload {
+	id := payload.Uint(m.ID)
+	p := payload.Map{keyID: &id}
+
+	if m.Method != "" {
+		method := payload.String(m.Method)
+		p[keyMethod] = &method
+	}
+
+	if m.Body != nil {
+		p[keyBody] = m.Body
+	}
+
+	if m.Error != "" {
+		msg := payload.String(m.Error)
+		p[keyError] = &msg
+	}
+
+	return &p
+}
+
+// parseMessage returns the Message p encodes.
+func parseMessage(p payload.Payload) (Message, error) {
+	var m Message
+
+	mp, ok := p.(*payload.Map)
+	if !ok {
+		return m, fmt.Errorf("invalid message type %T", p)
+	}
+
+	id, ok := (*mp)[keyID].(*payload.Uint)
+	if !ok {
+		return m, errors.New("invalid message ID")
+	}
+	m.ID = uint64(*id)
+
+	for key, value := range map[string]*string{keyMethod: &m.Method, keyError: &m.Error} {
+		v, ok := (*mp)[key]
+		if !ok {
+			continue
+		}
+
+		s, ok := v.(*payload.String)
+		if !ok {
+			return m, fmt.Errorf("invalid message %s", key)
+		}
+		*value = string(*s)
+	}
+
+	m.Body = (*mp)[keyBody]
+
+	return m, nil
+}
@@ -0,0 +1,394 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/payload"
+)
+
+// serve registers test handlers on s and serves it on a local address.
+func serve(t *testing.T, s *Server) string {
+	t.Helper()
+
+	s.Handle("echo", func(_ context.Context, body payload.Payload) (payload.Payload, error) {
+		return body, nil
+	})
+
+	s.Handle("sum", func(_ context.Context, body payload.Payload) (payload.Payload, error) {
+		list, ok := body.(*payload.List)
+		if !ok {
+			return nil, errors.New("expected a list")
+		}
+
+		var sum payload.Int
+		for _, p := range *list {
+			i, ok := p.(*payload.Int)
+			if !ok {
+				return nil, errors.New("expected integers")
+			}
+			sum += *i
+		}
+
+		return &sum, nil
+	})
+
+	// Handlers waiting on their context outlive a client that closes its
+	// connection cleanly, so end them with the test.
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	s.Handle("wait", func(ctx context.Context, _ payload.Payload) (payload.Payload, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-done:
+			return nil, errors.New("test over")
+		}
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() { _ = s.Serve(l) }()
+
+	return l.Addr().String()
+}
+
+func TestClientCall(t *testing.T) {
+	addr := serve(t, new(Server))
+	ctx := context.Background()
+
+	c, err := Dial(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+
+	// Concurrent calls share the connection and each gets its own response.
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			a, b := payload.Int(i), payload.Int(i*10)
+
+			resp, err := c.Call(ctx, "sum", &payload.List{&a, &b})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if expected := payload.Int(i * 11); !reflect.DeepEqual(&expected, resp) {
+				t.Errorf("expected %v; actual %v", expected, resp)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	s := payload.String("hello")
+
+	resp, err := c.Call(ctx, "echo", &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&s, resp) {
+		t.Errorf("expected %v; actual %v", s, resp)
+	}
+
+	resp, err = c.Call(ctx, "echo", nil)
+	if err != nil || resp != nil {
+		t.Errorf("expected a nil response; actual %v, %v", resp, err)
+	}
+
+	var sErr *ServerError
+
+	_, err = c.Call(ctx, "sum", &s)
+	if !errors.As(err, &sErr) || sErr.Message != "expected a list" {
+		t.Errorf("expected a server error; actual: %v", err)
+	}
+
+	_, err = c.Call(ctx, "missing", nil)
+	if !errors.As(err, &sErr) || sErr.Method != "missing" {
+		t.Errorf("expected a server error; actual: %v", err)
+	}
+}
+
+func TestClientCallCancel(t *testing.T) {
+	s := new(Server)
+	started := make(chan struct{}, 1)
+
+	s.Handle("block", func(ctx context.Context, _ payload.Payload) (payload.Payload, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	addr := serve(t, s)
+
+	c, err := Dial(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = c.Call(ctx, "wait", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded; actual: %v", err)
+	}
+
+	// The connection remains usable after a canceled call.
+	p := payload.String("still here")
+
+	_, err = c.Call(context.Background(), "echo", &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing the client fails calls in progress.
+	errs := make(chan error)
+
+	go func() {
+		_, err := c.Call(context.Background(), "block", nil)
+		errs <- err
+	}()
+
+	<-started // the call is in flight
+
+	_ = c.Close()
+
+	select {
+	case err = <-errs:
+		if !errors.Is(err, ErrClientClosed) {
+			t.Errorf("expected ErrClientClosed; actual: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call didn't return after Close")
+	}
+
+	_, err = c.Call(context.Background(), "echo", &p)
+	if !errors.Is(err, ErrClientClosed) {
+		t.Errorf("expected ErrClientClosed; actual: %v", err)
+	}
+}
+
+// eofConn holds back each Write's return until a Read fails, so a Client's
+// call waits for its response only after the response has arrived and the
+// connection has failed.
+type eofConn struct {
+	net.Conn
+	once sync.Once
+	eof  chan struct{}
+}
+
+func (c *eofConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err != nil {
+		c.once.Do(func() { close(c.eof) })
+	}
+
+	return n, err
+}
+
+func (c *eofConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+
+	select {
+	case <-c.eof:
+	case <-time.After(5 * time.Second):
+	}
+
+	return n, err
+}
+
+func TestClientCallResponseThenEOF(t *testing.T) {
+	// A server that answers and then closes the connection. The call still
+	// returns the response, though the client sees EOF right after it.
+	for i := 0; i < 50; i++ {
+		client, server := net.Pipe()
+
+		go func() {
+			defer func() { _ = server.Close() }()
+
+			p, err := payload.NewDecoder(server).Decode()
+			if err != nil {
+				return
+			}
+
+			req, err := parseMessage(p)
+			if err != nil {
+				return
+			}
+
+			_ = payload.NewEncoder(server).Encode(
+				Message{ID: req.ID, Body: req.Body}.Payload())
+		}()
+
+		c := NewClient(&eofConn{Conn: client, eof: make(chan struct{})})
+		body := payload.String("hello")
+
+		resp, err := c.Call(context.Background(), "echo", &body)
+		_ = c.Close()
+
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(resp, &body) {
+			t.Fatalf("%d: expected %v; actual %v", i, &body, resp)
+		}
+	}
+}
+
+func TestServerMaxPayloadSize(t *testing.T) {
+	addr := serve(t, &Server{MaxPayloadSize: 64})
+
+	c, err := Dial(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+
+	b := payload.Binary(make([]byte, 100))
+
+	_, err = c.Call(context.Background(), "echo", &b)
+	if err == nil {
+		t.Fatal("expected the server to reject the request")
+	}
+}
+
+func TestServerHalfClose(t *testing.T) {
+	s := new(Server)
+	release := make(chan struct{})
+
+	s.Handle("gate", func(_ context.Context, body payload.Payload) (payload.Payload, error) {
+		<-release
+		return body, nil
+	})
+
+	conn, err := net.Dial("tcp", serve(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Pipeline requests and close the sending side before the handlers
+	// respond. The server still sends every response.
+	enc := payload.NewEncoder(conn)
+
+	for i := uint64(1); i <= 5; i++ {
+		body := payload.Uint(i)
+
+		err = enc.Encode(Message{ID: i, Method: "gate", Body: &body}.Payload())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = conn.(*net.TCPConn).CloseWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	close(release)
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var (
+		dec = payload.NewDecoder(conn)
+		ids = make(map[uint64]bool)
+	)
+
+	for {
+		p, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := parseMessage(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Error != "" {
+			t.Errorf("request %d: %s", resp.ID, resp.Error)
+		}
+
+		ids[resp.ID] = true
+	}
+
+	if len(ids) != 5 {
+		t.Errorf("expected 5 responses; actual %d", len(ids))
+	}
+}
+
+func TestServerMaxConcurrent(t *testing.T) {
+	var (
+		s       = &Server{MaxConcurrent: 2}
+		started = make(chan struct{}, 5)
+		release = make(chan struct{})
+	)
+
+	s.Handle("gate", func(_ context.Context, body payload.Payload) (payload.Payload, error) {
+		started <- struct{}{}
+		<-release
+		return body, nil
+	})
+
+	c, err := Dial(context.Background(), "tcp", serve(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+
+	errs := make(chan error, 5)
+
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := c.Call(context.Background(), "gate", nil)
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for handlers to start")
+		}
+	}
+
+	// The remaining requests wait for a free slot.
+	select {
+	case <-started:
+		t.Fatal("expected at most 2 handlers running")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	for i := 0; i < 5; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
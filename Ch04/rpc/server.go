@@ -0,0 +1,179 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/nicholas-fedor/Network-Programming-with-Go/Ch04/payload"
+)
+
+const defaultMaxConcurrent = 64
+
+// HandlerFunc handles calls to a method. It returns the response body, which
+// may be nil, or an error the server reports to the client. The context is
+// canceled if reading requests from or writing responses to the client's
+// connection fails.
+type HandlerFunc func(ctx context.Context, body payload.Payload) (payload.Payload, error)
+
+// Server dispatches the requests it receives on each connection to the
+// handlers registered for their methods.
+type Server struct {
+	MaxPayloadSize uint32 // if set, the largest request the server accepts
+	MaxConcurrent  int    // the most requests handled at once per connection; 0 means 64
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+}
+
+// Handle registers the handler for method, replacing any registered before.
+func (s *Server) Handle(method string, handler HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.handlers == nil {
+		s.handlers = make(map[string]HandlerFunc)
+	}
+
+	s.handlers[method] = handler
+}
+
+// handler returns the handler registered for method.
+func (s *Server) handler(method string) (HandlerFunc, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	h, ok := s.handlers[method]
+
+	return h, ok
+}
+
+// Serve accepts connections on l and serves each in its own goroutine. It
+// returns when Accept fails, such as when l is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			err := s.ServeConn(conn)
+			if err != nil {
+				log.Printf("[%s] %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// ServeConn serves requests on conn until the client closes it or sends
+// something other than a request, then closes conn. It handles each request
+// in its own goroutine, up to MaxConcurrent at a time, so responses may arrive
+// out of order. Once the client closes its side of the connection, ServeConn
+// lets the handlers in progress finish and send their responses, since the
+// client may still be reading them. If the connection fails, ServeConn cancels
+// the handlers' context instead. Either way, it waits for its handlers to
+// return before returning.
+func (s *Server) ServeConn(conn net.Conn) error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	maxConcurrent := s.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultMaxConcurrent
+	}
+
+	var (
+		handlers sync.WaitGroup
+		slots    = make(chan struct{}, maxConcurrent)
+		wmu      sync.Mutex // serializes responses
+		enc      = payload.NewEncoder(conn)
+		dec      = payload.NewDecoder(conn)
+		eof      bool // whether the client closed its side of the connection
+	)
+
+	dec.MaxPayloadSize = s.MaxPayloadSize
+
+	defer func() {
+		if !eof {
+			cancel() // nobody will read the responses
+		}
+		handlers.Wait()
+		cancel()
+		_ = conn.Close()
+	}()
+
+	for {
+		p, err := dec.Decode()
+		if err != nil {
+			if err == io.EOF {
+				eof = true
+				return nil
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		req, err := parseMessage(p)
+		if err != nil {
+			return err
+		}
+
+		if req.Method == "" {
+			return fmt.Errorf("request %d: missing method", req.ID)
+		}
+
+		// Wait for a free slot. Not reading meanwhile pushes back on the
+		// client.
+		slots <- struct{}{}
+		handlers.Add(1)
+
+		go func() {
+			defer func() {
+				<-slots
+				handlers.Done()
+			}()
+
+			resp := s.call(ctx, req)
+			if ctx.Err() != nil {
+				return // the connection failed
+			}
+
+			wmu.Lock()
+			err := enc.Encode(resp.Payload())
+			wmu.Unlock()
+
+			if err != nil {
+				log.Printf("[%s] request %d: %v", conn.RemoteAddr(), req.ID, err)
+				cancel()
+			}
+		}()
+	}
+}
+
+// call returns the response to req.
+func (s *Server) call(ctx context.Context, req Message) Message {
+	resp := Message{ID: req.ID}
+
+	h, ok := s.handler(req.Method)
+	if !ok {
+		resp.Error = fmt.Sprintf("unknown method %q", req.Method)
+		return resp
+	}
+
+	body, err := h(ctx, req.Body)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Body = body
+
+	return resp
+}
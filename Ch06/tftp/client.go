@@ -0,0 +1,358 @@
+package tftp
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Client downloads files from and uploads files to TFTP servers.
+type Client struct {
+	Mode       string        // the transfer mode: octet (the default) or netascii
+	Retries    uint8         // the number of times to retry a failed transmission
+	Timeout    time.Duration // the duration to wait for a reply
+	BlockSize  int           // if set, the block size to request (RFC 2348)
+	WindowSize int           // if set, the window size to request (RFC 7440)
+	Rollover   uint16        // the block number following 65535: 0 (the default) or 1
+}
+
+// Get downloads filename from the server at addr and writes its contents to
+// w. It returns the number of bytes written. After a successful download, Get
+// keeps acknowledging retransmissions of the final data packet for one
+// timeout in the background, or until ctx is done.
+func (c Client) Get(ctx context.Context, addr, filename string, w io.Writer) (int64, error) {
+	conn, err := c.dial(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+
+	dallying := false
+	defer func() {
+		if !dallying {
+			_ = conn.Close()
+		}
+	}()
+
+	stop := context.AfterFunc(ctx, conn.cancel)
+	defer stop()
+
+	rrq := ReadReq{Filename: filename, Mode: c.Mode, Options: c.options()}
+	t := c.transfer()
+
+	// The server replies to the read request with an option acknowledgement
+	// if it accepted any of our options, or with the first data packet.
+	buf := make([]byte, 4+MaxBlockSize)
+
+	n, err := t.exchange(ctx, conn, rrq, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		oack    OAck
+		initial encoding.BinaryMarshaler
+	)
+
+	if oack.UnmarshalBinary(buf[:n]) == nil {
+		err = t.accept(oack, rrq.Options)
+		if err != nil {
+			_ = writeErr(conn, ErrBadOption, err.Error())
+			return 0, err
+		}
+
+		initial = Ack(0) // acknowledge the option acknowledgement
+	} else {
+		// let the transfer read the first data packet
+		conn.pending = append([]byte(nil), buf[:n]...)
+	}
+
+	var (
+		received int64
+		payload  io.Writer = &countWriter{w: w, n: &received}
+		finish   func() error
+	)
+
+	if isNetASCII(c.Mode) {
+		decoder := NewNetASCIIDecoder(payload)
+		payload, finish = decoder, decoder.Flush
+	}
+
+	_, err = t.receive(ctx, conn, payload, initial, finish)
+	if err != nil {
+		return received, c.cancelErr(ctx, conn, err)
+	}
+
+	dallying = true
+
+	go func() {
+		t.dally(ctx, conn)
+		_ = conn.Close()
+	}()
+
+	return received, nil
+}
+
+// Put uploads the contents of r to the server at addr as filename. It
+// returns the number of bytes read from r.
+func (c Client) Put(ctx context.Context, addr, filename string, r io.Reader) (int64, error) {
+	conn, err := c.dial(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	stop := context.AfterFunc(ctx, conn.cancel)
+	defer stop()
+
+	wrq := WriteReq{Filename: filename, Mode: c.Mode, Options: c.options()}
+	t := c.transfer()
+
+	// The server replies to the write request with an option acknowledgement
+	// if it accepted any of our options, or with ACK 0.
+	buf := make([]byte, DatagramSize)
+
+	n, err := t.exchange(ctx, conn, wrq, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		oack   OAck
+		ackPkt Ack
+	)
+
+	switch {
+	case oack.UnmarshalBinary(buf[:n]) == nil:
+		err = t.accept(oack, wrq.Options)
+		if err != nil {
+			_ = writeErr(conn, ErrBadOption, err.Error())
+			return 0, err
+		}
+	case ackPkt.UnmarshalBinary(buf[:n]) == nil && ackPkt == 0:
+	default:
+		_ = writeErr(conn, ErrIllegalOp, "expected ACK 0")
+		return 0, errors.New("expected ACK 0")
+	}
+
+	var (
+		sent    int64
+		payload io.Reader = &countReader{r: r, n: &sent}
+	)
+
+	if isNetASCII(c.Mode) {
+		payload = NewNetASCIIEncoder(payload)
+	}
+
+	_, err = t.send(ctx, conn, payload)
+
+	return sent, c.cancelErr(ctx, conn, err)
+}
+
+// dial returns a connection for a transfer with the server at addr.
+func (c Client) dial(ctx context.Context, addr string) (*peerConn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var lc net.ListenConfig
+
+	pc, err := lc.ListenPacket(ctx, "udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+
+	return &peerConn{PacketConn: pc, addr: raddr}, nil
+}
+
+// cancelErr tells the server we're abandoning the transfer if ctx is done.
+func (c Client) cancelErr(ctx context.Context, conn *peerConn, err error) error {
+	if err != nil && ctx.Err() != nil && conn.locked {
+		_ = writeErr(conn, ErrUnknown, "transfer canceled")
+	}
+
+	return err
+}
+
+// options returns the options to include in a request.
+func (c Client) options() map[string]string {
+	var opts map[string]string
+
+	set := func(name string, value int) {
+		if opts == nil {
+			opts = make(map[string]string)
+		}
+
+		opts[name] = strconv.Itoa(value)
+	}
+
+	if c.BlockSize > 0 {
+		set(OptBlockSize, c.BlockSize)
+	}
+
+	if c.WindowSize > 0 {
+		set(OptWindowSize, c.WindowSize)
+	}
+
+	return opts
+}
+
+// transfer returns the settings for a transfer before option negotiation.
+func (c Client) transfer() transfer {
+	t := transfer{
+		blockSize:  BlockSize,
+		timeout:    c.Timeout,
+		windowSize: 1,
+		retries:    c.Retries,
+		rollover:   c.Rollover,
+	}
+
+	if t.timeout == 0 {
+		t.timeout = 6 * time.Second
+	}
+
+	if t.retries == 0 {
+		t.retries = 10
+	}
+
+	return t
+}
+
+// accept applies the options the server acknowledged to the transfer. The
+// server may only acknowledge options the client requested, and it may only
+// lower the block and window sizes.
+func (t *transfer) accept(oack OAck, requested map[string]string) error {
+	for name, value := range oack {
+		req, ok := requested[name]
+		if !ok {
+			return fmt.Errorf("unrequested option %q", name)
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q", name, value)
+		}
+
+		limit, _ := strconv.Atoi(req)
+
+		switch name {
+		case OptBlockSize:
+			if n < MinBlockSize || n > limit {
+				return fmt.Errorf("invalid %s value %q", name, value)
+			}
+
+			t.blockSize = n
+		case OptWindowSize:
+			if n < 1 || n > limit {
+				return fmt.Errorf("invalid %s value %q", name, value)
+			}
+
+			t.windowSize = n
+		case OptTimeout:
+			if n < 1 || n > 255 {
+				return fmt.Errorf("invalid %s value %q", name, value)
+			}
+
+			t.timeout = time.Duration(n) * time.Second
+		}
+	}
+
+	return nil
+}
+
+// peerConn binds a net.PacketConn to the other end of a transfer. A client
+// sends its request to the server's well-known port, but the server replies
+// from a new port, its transfer identifier (TID). peerConn sends to addr until
+// it receives the first packet from addr's IP address, then locks onto the
+// sender's address. It answers packets from any other address with an
+// ErrUnknownID error.
+type peerConn struct {
+	net.PacketConn
+	addr    net.Addr
+	locked  bool
+	pending []byte // a packet for the next Read to return
+}
+
+func (c *peerConn) Read(p []byte) (int, error) {
+	if c.pending != nil {
+		n := copy(p, c.pending)
+		c.pending = nil
+
+		return n, nil
+	}
+
+	for {
+		n, addr, err := c.ReadFrom(p)
+		if err != nil {
+			return n, err
+		}
+
+		if !c.locked && sameIP(addr, c.addr) {
+			c.addr, c.locked = addr, true
+
+			return n, nil
+		}
+
+		if c.locked && addr.String() == c.addr.String() {
+			return n, nil
+		}
+
+		_ = writeErrTo(c.PacketConn, addr, ErrUnknownID, "unknown transfer ID")
+	}
+}
+
+// sameIP reports whether a and b are UDP addresses with the same IP address,
+// whatever their ports.
+func sameIP(a, b net.Addr) bool {
+	ua, ok := a.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+
+	ub, ok := b.(*net.UDPAddr)
+
+	return ok && ua.IP.Equal(ub.IP)
+}
+
+func (c *peerConn) Write(p []byte) (int, error) {
+	return c.WriteTo(p, c.addr)
+}
+
+// cancel interrupts a blocked Read.
+func (c *peerConn) cancel() {
+	_ = c.SetReadDeadline(time.Now())
+}
+
+// countWriter counts the bytes written to w in n, which it updates
+// atomically.
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(c.n, int64(n))
+
+	return n, err
+}
+
+// countReader counts the bytes read from r in n, which it updates
+// atomically.
+type countReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+
+	return n, err
+}
@@ -0,0 +1,501 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	p1 := make([]byte, 100_000)
+
+	_, err := rand.Read(p1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &memSink{files: make(map[string][]byte)}
+	s := Server{Root: fstest.MapFS{"test": {Data: p1}}, Sink: sink}
+	done := make(chan struct{})
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	addr := conn.LocalAddr().String()
+
+	for i, c := range []Client{
+		{},
+		{BlockSize: 1428},
+		{BlockSize: 1000}, // the payload is a multiple of the block size
+		{WindowSize: 8},
+		{BlockSize: 8192, WindowSize: 4},
+	} {
+		ctx := context.Background()
+
+		p2 := new(bytes.Buffer)
+
+		n, err := c.Get(ctx, addr, "test", p2)
+		if err != nil {
+			t.Fatalf("%d: get: %v", i, err)
+		}
+
+		if n != int64(len(p1)) {
+			t.Errorf("%d: expected %d bytes; read %d bytes", i, len(p1), n)
+		}
+
+		if !bytes.Equal(p1, p2.Bytes()) {
+			t.Errorf("%d: sent payload not equal to received payload", i)
+		}
+
+		filename := string(rune('a' + i))
+
+		n, err = c.Put(ctx, addr, filename, bytes.NewReader(p1))
+		if err != nil {
+			t.Fatalf("%d: put: %v", i, err)
+		}
+
+		if n != int64(len(p1)) {
+			t.Errorf("%d: expected %d bytes; wrote %d bytes", i, len(p1), n)
+		}
+
+		p3, ok := sink.file(filename)
+		if !ok {
+			t.Fatalf("%d: expected the sink to contain the uploaded file", i)
+		}
+
+		if !bytes.Equal(p1, p3) {
+			t.Errorf("%d: sent payload not equal to uploaded payload", i)
+		}
+	}
+
+	var c Client
+
+	_, err = c.Get(context.Background(), addr, "missing", new(bytes.Buffer))
+
+	var rErr *RemoteError
+	if !errors.As(err, &rErr) || rErr.Code != ErrNotFound {
+		t.Errorf("expected remote error code %d; actual %v", ErrNotFound, err)
+	}
+
+	_, err = c.Put(context.Background(), addr, "a", bytes.NewReader(p1))
+	if !errors.As(err, &rErr) || rErr.Code != ErrFileExists {
+		t.Errorf("expected remote error code %d; actual %v", ErrFileExists, err)
+	}
+
+	_ = conn.Close()
+
+	<-done
+}
+
+func TestClientCancel(t *testing.T) {
+	t.Parallel()
+
+	// a server that never replies
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	var c Client
+
+	_, err = c.Get(ctx, conn.LocalAddr().String(), "test", new(bytes.Buffer))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context deadline exceeded; actual %v", err)
+	}
+
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected Get to return promptly; took %s", d)
+	}
+}
+
+func TestClientUnknownTID(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name   string
+		ip     string // the intruder's address
+		before bool   // whether the intruder replies before the server
+	}{
+		// Once the server replies, packets from other ports are rejected.
+		{name: "after server", ip: "127.0.0.1"},
+		// Only the server's IP address may reply first, from any port.
+		{name: "before server", ip: "127.0.0.2", before: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server, err := net.ListenPacket("udp", "127.0.0.1:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = server.Close() }()
+
+			intruder, err := net.ListenPacket("udp", tc.ip+":")
+			if err != nil {
+				t.Skip(err)
+			}
+			defer func() { _ = intruder.Close() }()
+
+			// Reply to the read request with the first data packet, and
+			// inject a data packet from the intruder before or after it.
+			go func() {
+				buf := make([]byte, DatagramSize)
+
+				_, addr, err := server.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+
+				d := Data{Payload: bytes.NewReader(bytes.Repeat([]byte{'a'}, BlockSize))}
+				b, _ := d.MarshalBinary()
+
+				injected := Data{Payload: bytes.NewReader(bytes.Repeat([]byte{'x'}, BlockSize))}
+				bad, _ := injected.MarshalBinary()
+
+				if tc.before {
+					_, _ = intruder.WriteTo(bad, addr)
+				}
+
+				_, _ = server.WriteTo(b, addr)
+
+				if !tc.before {
+					_, _ = intruder.WriteTo(bad, addr)
+				}
+
+				// wait for the client's ACK before sending the final data packet
+				_, _, _ = server.ReadFrom(buf)
+
+				b, _ = d.MarshalBinary()
+				_, _ = server.WriteTo(b, addr)
+			}()
+
+			var c Client
+
+			p := new(bytes.Buffer)
+
+			n, err := c.Get(context.Background(), server.LocalAddr().String(), "test", p)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n != BlockSize {
+				t.Errorf("expected %d bytes; read %d bytes", BlockSize, n)
+			}
+
+			if expected := bytes.Repeat([]byte{'a'}, BlockSize); !bytes.Equal(p.Bytes(), expected) {
+				t.Error("expected the server's data, not the intruder's")
+			}
+
+			_ = intruder.SetReadDeadline(time.Now().Add(time.Second))
+
+			buf := make([]byte, DatagramSize)
+
+			n2, _, err := intruder.ReadFrom(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var errPkt Err
+
+			err = errPkt.UnmarshalBinary(buf[:n2])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if errPkt.Error != ErrUnknownID {
+				t.Errorf("expected error code %d; actual %d", ErrUnknownID, errPkt.Error)
+			}
+		})
+	}
+}
+
+func TestClientGetDally(t *testing.T) {
+	t.Parallel()
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = server.Close() }()
+
+	// Reply to the read request with the only data packet, and send it again
+	// after the client's acknowledgement, as if the acknowledgement were lost.
+	acks := make(chan uint16, 2)
+
+	go func() {
+		buf := make([]byte, DatagramSize)
+
+		_, addr, err := server.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		b, _ := (&Data{Payload: strings.NewReader("short")}).MarshalBinary()
+
+		for i := 0; i < 2; i++ {
+			_, _ = server.WriteTo(b, addr)
+
+			_ = server.SetReadDeadline(time.Now().Add(time.Second))
+
+			n, _, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var ack Ack
+			if ack.UnmarshalBinary(buf[:n]) == nil {
+				acks <- uint16(ack)
+			}
+		}
+	}()
+
+	c := Client{Timeout: time.Second}
+	p := new(bytes.Buffer)
+
+	_, err = c.Get(context.Background(), server.LocalAddr().String(), "test", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.String() != "short" {
+		t.Errorf("expected %q; actual %q", "short", p)
+	}
+
+	// Get returned, but the client still acknowledges the retransmission.
+	for i := 0; i < 2; i++ {
+		select {
+		case ack := <-acks:
+			if ack != 1 {
+				t.Errorf("expected ACK 1; actual %d", ack)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for ACK %d of 2", i+1)
+		}
+	}
+}
+
+func TestClientGetDallyCancel(t *testing.T) {
+	t.Parallel()
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = server.Close() }()
+
+	b, err := (&Data{Payload: strings.NewReader("short")}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reply to the read request with the only data packet from a connected
+	// socket, which learns when the client's socket closes.
+	transfers := make(chan net.Conn, 1)
+
+	go func() {
+		buf := make([]byte, DatagramSize)
+
+		_, addr, err := server.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		conn, err := net.Dial("udp", addr.String())
+		if err != nil {
+			return
+		}
+
+		_, _ = conn.Write(b)
+		transfers <- conn
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := Client{Timeout: time.Minute}
+
+	_, err = c.Get(ctx, server.LocalAddr().String(), "test", new(bytes.Buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := <-transfers
+	defer func() { _ = conn.Close() }()
+
+	// Canceling the context ends the dally well before its timeout, closing
+	// the client's socket, so retransmissions are refused.
+	cancel()
+
+	buf := make([]byte, DatagramSize)
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the client to stop dallying")
+		}
+
+		_, _ = conn.Write(b)
+		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+		_, err = conn.Read(buf)
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			break
+		}
+	}
+}
+
+func TestClientNetASCII(t *testing.T) {
+	t.Parallel()
+
+	// a text file spanning several blocks, with line endings at block
+	// boundaries
+	text := bytes.Repeat([]byte("a line of text\r\nanother line\n"+
+		strings.Repeat("x", BlockSize-29)+"\r"), 4)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &memSink{files: make(map[string][]byte)}
+	s := Server{Root: fstest.MapFS{"text": {Data: text}}, Sink: sink}
+	done := make(chan struct{})
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	// the server translates the file into netascii on the wire
+	wire, _, errPkt := download(t, conn.LocalAddr(), ReadReq{Filename: "text", Mode: "netascii"})
+	if errPkt != nil {
+		t.Fatal(errPkt.Message)
+	}
+
+	encoded, err := io.ReadAll(NewNetASCIIEncoder(bytes.NewReader(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(encoded, wire) {
+		t.Fatal("expected the server to send netascii")
+	}
+
+	c := Client{Mode: "netascii"}
+	addr := conn.LocalAddr().String()
+
+	p := new(bytes.Buffer)
+
+	_, err = c.Get(context.Background(), addr, "text", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(text, p.Bytes()) {
+		t.Error("downloaded text not equal to original text")
+	}
+
+	_, err = c.Put(context.Background(), addr, "upload", bytes.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p2, ok := sink.file("upload")
+	if !ok {
+		t.Fatal("expected the sink to contain the uploaded file")
+	}
+
+	if !bytes.Equal(text, p2) {
+		t.Error("uploaded text not equal to original text")
+	}
+
+	_ = conn.Close()
+
+	<-done
+}
+
+func TestClientRollover(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping a 33 MB transfer in short mode")
+	}
+
+	t.Parallel()
+
+	// more than 65535 blocks of the default block size
+	p1 := make([]byte, 33<<20)
+
+	_, err := rand.Read(p1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rollover := range []uint16{0, 1} {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sink := &memSink{files: make(map[string][]byte)}
+		s := Server{
+			Root:     fstest.MapFS{"test": {Data: p1}},
+			Sink:     sink,
+			Rollover: rollover,
+		}
+		done := make(chan struct{})
+
+		go func() {
+			_ = s.Serve(conn)
+			close(done)
+		}()
+
+		var (
+			addr = conn.LocalAddr().String()
+			ctx  = context.Background()
+			c    = Client{WindowSize: 16, Rollover: rollover}
+			p2   = new(bytes.Buffer)
+		)
+
+		_, err = c.Get(ctx, addr, "test", p2)
+		if err != nil {
+			t.Fatalf("rollover %d: get: %v", rollover, err)
+		}
+
+		if !bytes.Equal(p1, p2.Bytes()) {
+			t.Errorf("rollover %d: sent payload not equal to received payload", rollover)
+		}
+
+		_, err = c.Put(ctx, addr, "upload", bytes.NewReader(p1))
+		if err != nil {
+			t.Fatalf("rollover %d: put: %v", rollover, err)
+		}
+
+		p3, _ := sink.file("upload")
+		if !bytes.Equal(p1, p3) {
+			t.Errorf("rollover %d: sent payload not equal to uploaded payload", rollover)
+		}
+
+		_ = conn.Close()
+
+		<-done
+	}
+}
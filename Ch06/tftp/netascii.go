@@ -0,0 +1,122 @@
+package tftp
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// isNetASCII reports whether mode is the netascii transfer mode. Mode names
+// are case-insensitive.
+func isNetASCII(mode string) bool { return strings.EqualFold(mode, "netascii") }
+
+// NetASCIIEncoder translates text read from an underlying reader into
+// netascii (RFC 1350, by way of RFC 764): it sends each LF as CR LF, and each
+// CR as CR NUL.
+type NetASCIIEncoder struct {
+	r       *bufio.Reader
+	pending byte // the second byte of a translated pair
+	has     bool // true if pending holds a byte
+}
+
+func NewNetASCIIEncoder(r io.Reader) *NetASCIIEncoder {
+	return &NetASCIIEncoder{r: bufio.NewReader(r)}
+}
+
+func (e *NetASCIIEncoder) Read(p []byte) (int, error) {
+	n := 0
+
+	for n < len(p) {
+		if e.has {
+			p[n] = e.pending
+			e.has = false
+			n++
+
+			continue
+		}
+
+		c, err := e.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && n > 0 {
+				err = nil
+			}
+
+			return n, err
+		}
+
+		switch c {
+		case '\n':
+			p[n], e.pending, e.has = '\r', '\n', true
+		case '\r':
+			p[n], e.pending, e.has = '\r', 0, true
+		default:
+			p[n] = c
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// NetASCIIDecoder translates netascii written to it back into text before
+// writing it to an underlying writer: CR LF becomes LF, and CR NUL becomes
+// CR. Since a CR may end one write and its partner begin the next, callers
+// must call Flush after the final write.
+type NetASCIIDecoder struct {
+	w   io.Writer
+	cr  bool // true if the last byte written was a CR
+	buf []byte
+}
+
+func NewNetASCIIDecoder(w io.Writer) *NetASCIIDecoder {
+	return &NetASCIIDecoder{w: w}
+}
+
+func (d *NetASCIIDecoder) Write(p []byte) (int, error) {
+	d.buf = d.buf[:0]
+
+	for _, c := range p {
+		if d.cr {
+			d.cr = false
+
+			switch c {
+			case '\n':
+				d.buf = append(d.buf, '\n')
+				continue
+			case 0:
+				d.buf = append(d.buf, '\r')
+				continue
+			default:
+				// A CR without a partner isn't valid netascii. Keep it.
+				d.buf = append(d.buf, '\r')
+			}
+		}
+
+		if c == '\r' {
+			d.cr = true
+			continue
+		}
+
+		d.buf = append(d.buf, c)
+	}
+
+	_, err := d.w.Write(d.buf)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Flush writes a trailing CR, if any, to the underlying writer.
+func (d *NetASCIIDecoder) Flush() error {
+	if !d.cr {
+		return nil
+	}
+
+	d.cr = false
+	_, err := d.w.Write([]byte{'\r'})
+
+	return err
+}
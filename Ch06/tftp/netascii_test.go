@@ -0,0 +1,77 @@
+package tftp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNetASCII(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		text     string
+		netascii string
+	}{
+		{"", ""},
+		{"plain text", "plain text"},
+		{"line 1\nline 2\n", "line 1\r\nline 2\r\n"},
+		{"carriage\rreturn", "carriage\r\x00return"},
+		{"windows\r\nline", "windows\r\x00\r\nline"},
+		{"\r\r\n\n", "\r\x00\r\x00\r\n\r\n"},
+		{"trailing\r", "trailing\r\x00"},
+	} {
+		// one byte at a time exercises translated pairs split across reads
+		b, err := io.ReadAll(iotest.OneByteReader(
+			NewNetASCIIEncoder(bytes.NewReader([]byte(tc.text)))))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != tc.netascii {
+			t.Errorf("encode %q: expected %q; actual %q", tc.text, tc.netascii, b)
+		}
+
+		// one byte at a time exercises translated pairs split across writes
+		text := new(bytes.Buffer)
+		d := NewNetASCIIDecoder(text)
+
+		for i := range len(tc.netascii) {
+			_, err = d.Write([]byte{tc.netascii[i]})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = d.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if text.String() != tc.text {
+			t.Errorf("decode %q: expected %q; actual %q", tc.netascii, tc.text, text)
+		}
+	}
+}
+
+func TestNetASCIIDecoderInvalid(t *testing.T) {
+	t.Parallel()
+
+	text := new(bytes.Buffer)
+	d := NewNetASCIIDecoder(text)
+
+	_, err := d.Write([]byte("bare\rcarriage return\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "bare\rcarriage return\r"; text.String() != expected {
+		t.Errorf("expected %q; actual %q", expected, text)
+	}
+}
@@ -0,0 +1,73 @@
+package tftp
+
+import (
+	"errors"
+	"time"
+)
+
+// Observer receives events describing a server's transfers, for logging and
+// metrics. The server calls its methods from each transfer's goroutine, so
+// they must be safe for concurrent use and should return quickly.
+type Observer interface {
+	// TransferStarted is called when the server accepts a request.
+	TransferStarted(s Session)
+
+	// BlockRetransmitted is called when the server resends a data packet
+	// after a timeout. For uploads, the server resends its acknowledgement
+	// of the block instead.
+	BlockRetransmitted(s Session, block uint16)
+
+	// ErrorReceived is called when the client sends an error packet.
+	ErrorReceived(s Session, err *RemoteError)
+
+	// TransferCompleted is called when a transfer ends, successfully or not.
+	TransferCompleted(s Session, r TransferResult)
+}
+
+// TransferResult describes the outcome of a transfer.
+type TransferResult struct {
+	Bytes    int64         // bytes read from the file or written to the sink
+	Blocks   int64         // data packets transferred
+	Duration time.Duration // time from the request to the end of the transfer
+	Err      error         // nil if the transfer succeeded
+}
+
+// run runs a transfer, reporting its events to the server's Observer, and
+// stops tracking its session when it's done.
+func (s *Server) run(ss *session, transfer func() error) {
+	defer s.endSession(ss)
+
+	if s.Observer == nil {
+		_ = transfer()
+		return
+	}
+
+	s.Observer.TransferStarted(ss.snapshot())
+
+	err := transfer()
+
+	var rErr *RemoteError
+	if errors.As(err, &rErr) {
+		s.Observer.ErrorReceived(ss.snapshot(), rErr)
+	}
+
+	snapshot := ss.snapshot()
+
+	s.Observer.TransferCompleted(snapshot, TransferResult{
+		Bytes:    snapshot.Bytes,
+		Blocks:   snapshot.Blocks,
+		Duration: time.Since(snapshot.Start),
+		Err:      err,
+	})
+}
+
+// observe hooks the transfer up to the session and the server's Observer.
+func (s *Server) observe(ss *session, t *transfer) {
+	t.progress = ss.setBlocks
+
+	if s.Observer != nil {
+		t.retransmit = func(block uint16) {
+			s.Observer.BlockRetransmitted(ss.snapshot(), block)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is an Observer that records the events it receives.
+type recorder struct {
+	mu            sync.Mutex
+	started       []Session
+	retransmitted []uint16
+	errs          []*RemoteError
+	results       []TransferResult
+	done          chan struct{}
+}
+
+func newRecorder() *recorder { return &recorder{done: make(chan struct{}, 1)} }
+
+func (r *recorder) TransferStarted(s Session) {
+	r.mu.Lock()
+	r.started = append(r.started, s)
+	r.mu.Unlock()
+}
+
+func (r *recorder) BlockRetransmitted(_ Session, block uint16) {
+	r.mu.Lock()
+	r.retransmitted = append(r.retransmitted, block)
+	r.mu.Unlock()
+}
+
+func (r *recorder) ErrorReceived(_ Session, err *RemoteError) {
+	r.mu.Lock()
+	r.errs = append(r.errs, err)
+	r.mu.Unlock()
+}
+
+func (r *recorder) TransferCompleted(_ Session, result TransferResult) {
+	r.mu.Lock()
+	r.results = append(r.results, result)
+	r.mu.Unlock()
+
+	r.done <- struct{}{}
+}
+
+func (r *recorder) wait(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-r.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the transfer to complete")
+	}
+}
+
+func TestServerObserver(t *testing.T) {
+	t.Parallel()
+
+	payload := bytes.Repeat([]byte("observed"), 200) // 1600 bytes; 4 blocks
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := newRecorder()
+	s := Server{
+		Payload:  payload,
+		Sink:     &memSink{files: make(map[string][]byte)},
+		Timeout:  100 * time.Millisecond,
+		Observer: rec,
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	defer func() {
+		_ = conn.Close()
+		<-done
+	}()
+
+	// A successful download reports the bytes and blocks it sent.
+	var (
+		c   Client
+		buf bytes.Buffer
+	)
+
+	_, err = c.Get(context.Background(), conn.LocalAddr().String(), "test", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec.wait(t)
+
+	rec.mu.Lock()
+	if len(rec.started) != 1 || rec.started[0].Op != OpRRQ ||
+		rec.started[0].Filename != "test" {
+		t.Errorf("unexpected started sessions: %v", rec.started)
+	}
+
+	if r := rec.results[0]; r.Err != nil || r.Bytes != int64(len(payload)) ||
+		r.Blocks != 4 || r.Duration <= 0 {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	rec.mu.Unlock()
+
+	// An upload reports the bytes written to the sink.
+	_, err = c.Put(context.Background(), conn.LocalAddr().String(), "upload",
+		bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec.wait(t)
+
+	rec.mu.Lock()
+	if r := rec.results[1]; r.Err != nil || r.Bytes != int64(len(payload)) {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	rec.mu.Unlock()
+
+	// A client that never acknowledges the first data packet causes a
+	// retransmission, and its error packet ends the transfer.
+	client, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	b, err := ReadReq{Filename: "test"}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WriteTo(b, conn.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		addr net.Addr
+		p    = make([]byte, DatagramSize)
+	)
+
+	for i := 0; i < 2; i++ { // the original and the retransmission
+		_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+		n, a, err := client.ReadFrom(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var data Data
+
+		err = data.UnmarshalBinary(p[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data.Block != 1 {
+			t.Fatalf("expected block 1; actual block %d", data.Block)
+		}
+
+		addr = a
+	}
+
+	b, err = Err{Error: ErrDiskFull, Message: "full"}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WriteTo(b, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec.wait(t)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if len(rec.retransmitted) == 0 || rec.retransmitted[0] != 1 {
+		t.Errorf("expected block 1 retransmitted; actual %v", rec.retransmitted)
+	}
+
+	if len(rec.errs) != 1 || rec.errs[0].Code != ErrDiskFull {
+		t.Errorf("expected ErrDiskFull received; actual %v", rec.errs)
+	}
+
+	var rErr *RemoteError
+	if r := rec.results[2]; !errors.As(r.Err, &rErr) {
+		t.Errorf("expected a remote error; actual %v", r.Err)
+	}
+}
@@ -0,0 +1,210 @@
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option names a client may include in read and write requests.
+const (
+	OptBlockSize    = "blksize"    // block size in bytes (RFC 2348)
+	OptTimeout      = "timeout"    // retransmission timeout in seconds (RFC 2349)
+	OptTransferSize = "tsize"      // transfer size in bytes (RFC 2349)
+	OptWindowSize   = "windowsize" // data packets per acknowledgement (RFC 7440)
+)
+
+// maxWindowSize limits the window size the server accepts, since it holds a
+// window's worth of data packets in memory for retransmission.
+const maxWindowSize = 64
+
+// OAck is an option acknowledgement. The server sends it in response to a
+// request with options to tell the client which options it accepted and their
+// final values.
+type OAck map[string]string
+
+func (o OAck) MarshalBinary() ([]byte, error) {
+	// operation code + options
+	cap := 2 + optionsLen(o)
+
+	b := new(bytes.Buffer)
+	b.Grow(cap)
+
+	err := binary.Write(b, binary.BigEndian, OpOAck) // write operation code
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeOptions(b, o) // write options
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func (o *OAck) UnmarshalBinary(p []byte) error {
+	r := bytes.NewBuffer(p)
+
+	var code OpCode
+
+	err := binary.Read(r, binary.BigEndian, &code) // read operation code
+	if err != nil {
+		return errors.New("invalid OACK")
+	}
+
+	if code != OpOAck {
+		return errors.New("invalid OACK")
+	}
+
+	opts, err := readOptions(r) // read options
+	if err != nil {
+		return errors.New("invalid OACK")
+	}
+
+	*o = OAck(opts)
+	if *o == nil {
+		*o = OAck{}
+	}
+
+	return nil
+}
+
+// optionsLen returns the number of bytes writeOptions writes for opts.
+func optionsLen(opts map[string]string) int {
+	n := 0
+	for name, value := range opts {
+		n += len(name) + 1 + len(value) + 1
+	}
+
+	return n
+}
+
+// writeOptions writes each option as a null-terminated name followed by a
+// null-terminated value. It sorts options by name so the output is stable.
+func writeOptions(b *bytes.Buffer, opts map[string]string) error {
+	for _, name := range slices.Sorted(maps.Keys(opts)) {
+		for _, s := range []string{name, opts[name]} {
+			_, err := b.WriteString(s)
+			if err != nil {
+				return err
+			}
+
+			err = b.WriteByte(0) // write 0 byte
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readOptions reads null-terminated option name and value pairs until it
+// exhausts r. Option names are case-insensitive, so readOptions converts them
+// to lowercase. It returns a nil map if r contains no options.
+func readOptions(r *bytes.Buffer) (map[string]string, error) {
+	var opts map[string]string
+
+	for r.Len() > 0 {
+		name, err := r.ReadString(0) // read option name
+		if err != nil {
+			return nil, err
+		}
+
+		name = strings.ToLower(strings.TrimRight(name, "\x00"))
+		if name == "" {
+			return nil, errors.New("empty option name")
+		}
+
+		value, err := r.ReadString(0) // read option value
+		if err != nil {
+			return nil, err
+		}
+
+		if opts == nil {
+			opts = make(map[string]string)
+		}
+
+		opts[name] = strings.TrimRight(value, "\x00")
+	}
+
+	return opts, nil
+}
+
+// negotiate returns the settings for a transfer given the options the client
+// requested, and the option acknowledgement to send the client. The server
+// ignores options it does not recognize or whose values are invalid, per
+// RFC 2347. The size is the length of the file a client requested to read, or
+// -1 if unknown. The returned OAck is nil if the server accepted no options,
+// in which case the transfer proceeds as if the client requested none.
+func (s *Server) negotiate(requested map[string]string, size int64) (transfer, OAck) {
+	t := transfer{
+		blockSize:  BlockSize,
+		timeout:    s.Timeout,
+		windowSize: 1,
+		retries:    s.Retries,
+		rollover:   s.Rollover,
+	}
+
+	var oack OAck
+
+	accept := func(name, value string) {
+		if oack == nil {
+			oack = make(OAck)
+		}
+
+		oack[name] = value
+	}
+
+	for name, value := range requested {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch name {
+		case OptBlockSize:
+			if n < MinBlockSize {
+				continue
+			}
+
+			// The server may reply with a smaller block size than requested.
+			t.blockSize = int(min(n, MaxBlockSize))
+			accept(name, strconv.Itoa(t.blockSize))
+		case OptTimeout:
+			if n < 1 || n > 255 {
+				continue
+			}
+
+			t.timeout = time.Duration(n) * time.Second
+			accept(name, value)
+		case OptWindowSize:
+			if n < 1 || n > 65535 {
+				continue
+			}
+
+			// The server may reply with a smaller window size than requested.
+			t.windowSize = int(min(n, maxWindowSize))
+			accept(name, strconv.Itoa(t.windowSize))
+		case OptTransferSize:
+			// In netascii mode, size is the length of the file before
+			// translation, which RFC 2349 permits.
+			switch {
+			case n < 0:
+				continue
+			case size < 0:
+				accept(name, value) // the client tells us the size of a write
+			default:
+				accept(name, strconv.FormatInt(size, 10))
+			}
+		}
+	}
+
+	return t, oack
+}
@@ -4,19 +4,51 @@ package tftp
 
 import (
 	"bytes"
+	"context"
+	"encoding"
+	"encoding/binary"
 	"errors"
+	"io"
+	"io/fs"
 	"log"
 	"net"
+	"path"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Server struct {
 	Payload []byte        // the payload served for all read requests
+	Root    fs.FS         // if set, serves requested files by name instead of Payload
+	Sink    Sink          // the destination of files from write requests
 	Retries uint8         // the number of times to retry a failed transmission
 	Timeout time.Duration // the duration to wait for an acknowledgement
+
+	// Rollover is the block number following 65535 in transfers longer than
+	// 65535 blocks: 0 (the default) or 1. The protocol doesn't negotiate it,
+	// so it must match the client's setting.
+	Rollover uint16
+
+	Observer Observer // if set, receives events describing each transfer
+
+	MaxTransfers      int // the maximum concurrent transfers; unlimited if zero
+	MaxTransfersPerIP int // the maximum concurrent transfers per client IP; unlimited if zero
+
+	mu             sync.Mutex
+	sessions       map[*session]struct{}
+	transfersPerIP map[string]int
+	listeners      map[net.PacketConn]struct{}
+	inShutdown     bool
+	transfers      sync.WaitGroup     // transfers in progress
+	abort          context.CancelFunc // cancels transfers in progress
+	abortCtx       context.Context
 }
 
-func (s Server) ListenAndServe(addr string) error {
+// ErrServerClosed is returned by the Serve methods after a call to Shutdown.
+var ErrServerClosed = errors.New("tftp: Server closed")
+
+func (s *Server) ListenAndServe(addr string) error {
 	conn, err := net.ListenPacket("udp", addr)
 	if err != nil {
 		return err
@@ -28,13 +60,22 @@ func (s Server) ListenAndServe(addr string) error {
 	return s.Serve(conn)
 }
 
+// Serve reads requests from conn and handles each in a new goroutine. It
+// always returns a non-nil error. After Shutdown, the returned error is
+// ErrServerClosed.
 func (s *Server) Serve(conn net.PacketConn) error {
+	return s.ServeContext(context.Background(), conn)
+}
+
+// ServeContext is like Serve, but it stops when ctx is done. It then cancels
+// the transfers it started and returns ctx's error once they've stopped.
+func (s *Server) ServeContext(ctx context.Context, conn net.PacketConn) error {
 	if conn == nil {
 		return errors.New("nil connection")
 	}
 
-	if s.Payload == nil {
-		return errors.New("payload is required")
+	if s.Payload == nil && s.Root == nil && s.Sink == nil {
+		return errors.New("payload, root, or sink is required")
 	}
 
 	if s.Retries == 0 {
@@ -45,92 +86,417 @@ func (s *Server) Serve(conn net.PacketConn) error {
 		s.Timeout = 6 * time.Second
 	}
 
-	var rrq ReadReq
+	abortCtx, err := s.trackListener(conn)
+	if err != nil {
+		return err
+	}
+	defer s.untrackListener(conn)
+
+	// Transfers stop when either ctx is done or Shutdown gives up waiting
+	// for them.
+	ctx, cancel := context.WithCancel(ctx)
+
+	stopAbort := context.AfterFunc(abortCtx, cancel)
+
+	// Interrupt ReadFrom when ctx is done.
+	stopRead := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stopRead()
+
+	var (
+		rrq       ReadReq
+		wrq       WriteReq
+		transfers sync.WaitGroup // transfers started by this call
+	)
+
+	// Transfers may outlive this call if Shutdown stops it. Release their
+	// context once they finish.
+	defer func() {
+		go func() {
+			transfers.Wait()
+			stopAbort()
+			cancel()
+		}()
+	}()
 
 	for {
 		buf := make([]byte, DatagramSize)
 
-		_, addr, err := conn.ReadFrom(buf)
+		n, addr, err := conn.ReadFrom(buf)
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+
+			if ctx.Err() != nil {
+				transfers.Wait()
+				return ctx.Err()
+			}
+
 			return err
 		}
 
-		err = rrq.UnmarshalBinary(buf)
-		if err != nil {
-			log.Printf("[%s] bad request: %v", addr, err)
-			continue
+		var code OpCode
+		if n >= 2 {
+			code = OpCode(binary.BigEndian.Uint16(buf[:2]))
+		}
+
+		var ss *session
+
+		switch code {
+		case OpWRQ:
+			err = wrq.UnmarshalBinary(buf[:n])
+			if err != nil {
+				log.Printf("[%s] bad request: %v", addr, err)
+				continue
+			}
+
+			ss, err = s.startSession(addr, wrq.Filename, OpWRQ)
+			if err != nil {
+				break
+			}
+
+			transfers.Add(1)
+
+			go func(wrq WriteReq) {
+				defer transfers.Done()
+
+				var dally func()
+
+				s.run(ss, func() (err error) {
+					dally, err = s.handleWrite(ctx, ss, wrq)
+					return err
+				})
+
+				if dally != nil {
+					dally()
+				}
+			}(wrq)
+		default:
+			err = rrq.UnmarshalBinary(buf[:n])
+			if err != nil {
+				log.Printf("[%s] bad request: %v", addr, err)
+				continue
+			}
+
+			ss, err = s.startSession(addr, rrq.Filename, OpRRQ)
+			if err != nil {
+				break
+			}
+
+			transfers.Add(1)
+
+			go func(rrq ReadReq) {
+				defer transfers.Done()
+				s.run(ss, func() error { return s.handle(ctx, ss, rrq) })
+			}(rrq)
 		}
 
-		go s.handle(addr.String(), rrq)
+		if err != nil {
+			// Reply from the listening socket so rejecting a request doesn't
+			// cost a new socket.
+			log.Printf("[%s] rejected request: %v", addr, err)
+			_ = writeErrTo(conn, addr, ErrUnknown, err.Error())
+		}
 	}
 }
 
 // Pages 133-134
 // Listing 6-10: Handling read requests.
-func (s Server) handle(clientAddr string, rrq ReadReq) {
+func (s *Server) handle(ctx context.Context, ss *session, rrq ReadReq) error {
+	clientAddr := ss.ClientAddr
 	log.Printf("[%s] requested file: %s", clientAddr, rrq.Filename)
 
 	conn, err := net.Dial("udp", clientAddr)
 	if err != nil {
 		log.Printf("[%s] dial: %v", clientAddr, err)
-		return
+		return err
 	}
 	defer func() { _ = conn.Close() }()
 
-	var (
-		ackPkt  Ack
-		errPkt  Err
-		dataPkt = Data{Payload: bytes.NewReader(s.Payload)}
-		buf     = make([]byte, DatagramSize)
-	)
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	r, size, err := s.open(rrq.Filename)
+	if err != nil {
+		log.Printf("[%s] open %s: %v", clientAddr, rrq.Filename, err)
+		_ = writeErr(conn, errCode(err), err.Error())
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	var payload io.Reader = &countReader{r: r, n: &ss.bytes}
+	if isNetASCII(rrq.Mode) {
+		payload = NewNetASCIIEncoder(payload)
+	}
 
-NEXTPACKET:
-	for n := DatagramSize; n == DatagramSize; {
-		data, err := dataPkt.MarshalBinary()
+	t, oack := s.negotiate(rrq.Options, size)
+	s.observe(ss, &t)
+	if oack != nil {
+		err = sendOAck(ctx, conn, t, oack)
 		if err != nil {
-			log.Printf("[%s] preparing data packet: %v", clientAddr, err)
-			return
+			log.Printf("[%s] option negotiation: %v", clientAddr, err)
+			abandon(ctx, conn)
+			return err
 		}
+	}
 
-	RETRY:
-		for i := s.Retries; i > 0; i-- {
-			n, err = conn.Write(data) // send the data packet
+	blocks, err := t.send(ctx, conn, payload)
+	if err != nil {
+		log.Printf("[%s] %v", clientAddr, err)
+		abandon(ctx, conn)
+		return err
+	}
+
+	log.Printf("[%s] sent %d blocks", clientAddr, blocks)
+
+	return nil
+}
+
+// sendOAck sends the option acknowledgement to the client and waits for the
+// client to acknowledge it with block number 0.
+func sendOAck(ctx context.Context, conn net.Conn, t transfer, oack OAck) error {
+	buf := make([]byte, DatagramSize)
+
+	n, err := t.exchange(ctx, conn, oack, buf)
+	if err != nil {
+		return err
+	}
+
+	var ackPkt Ack
+
+	if ackPkt.UnmarshalBinary(buf[:n]) != nil || ackPkt != 0 {
+		return errors.New("expected ACK 0")
+	}
+
+	return nil
+}
+
+// open returns the contents of the requested file and its size. If the server
+// has a Root, open resolves filename inside it. Otherwise, every filename
+// refers to the server's Payload.
+func (s *Server) open(filename string) (io.ReadCloser, int64, error) {
+	if s.Root == nil {
+		if s.Payload == nil {
+			return nil, 0, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
+		}
+
+		return io.NopCloser(bytes.NewReader(s.Payload)), int64(len(s.Payload)), nil
+	}
+
+	name, err := resolve(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := s.Root.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+
+	if !info.Mode().IsRegular() {
+		_ = f.Close()
+		return nil, 0, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrPermission}
+	}
+
+	return f, info.Size(), nil
+}
+
+// resolve converts a filename from a request into a name suitable for fs.FS.
+// Clients often prefix filenames with a slash, so resolve treats absolute
+// filenames as relative to the root. Filenames that would escape the root,
+// such as ../etc/passwd, result in a permission error.
+func resolve(filename string) (string, error) {
+	name := path.Clean(strings.TrimLeft(filename, "/"))
+
+	if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+		return "", &fs.PathError{Op: "open", Path: filename, Err: fs.ErrPermission}
+	}
+
+	return name, nil
+}
+
+// handleWrite receives a file from the client and writes it to the server's
+// Sink. The server acknowledges the write request with block number 0, or
+// with an option acknowledgement if it accepted any of the client's options,
+// and each data packet with its block number, until it receives a data packet
+// shorter than a full block. Once the transfer succeeds, handleWrite returns a
+// function that dallies on the transfer's connection and then closes it.
+func (s *Server) handleWrite(ctx context.Context, ss *session, wrq WriteReq) (func(), error) {
+	clientAddr := ss.ClientAddr
+	log.Printf("[%s] uploading file: %s", clientAddr, wrq.Filename)
+
+	conn, err := net.Dial("udp", clientAddr)
+	if err != nil {
+		log.Printf("[%s] dial: %v", clientAddr, err)
+		return nil, err
+	}
+
+	dallying := false
+	defer func() {
+		if !dallying {
+			_ = conn.Close()
+		}
+	}()
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	if s.Sink == nil {
+		err = errors.New("write requests not supported")
+		_ = writeErr(conn, ErrIllegalOp, err.Error())
+		return nil, err
+	}
+
+	w, err := s.Sink.Create(wrq.Filename)
+	if err != nil {
+		log.Printf("[%s] create %s: %v", clientAddr, wrq.Filename, err)
+		_ = writeErr(conn, errCode(err), err.Error())
+		return nil, err
+	}
+
+	t, oack := s.negotiate(wrq.Options, -1)
+	s.observe(ss, &t)
+
+	// The option acknowledgement takes the place of ACK 0.
+	var initial encoding.BinaryMarshaler = Ack(0)
+	if oack != nil {
+		initial = oack
+	}
+
+	var (
+		payload io.Writer = &countWriter{w: w, n: &ss.bytes}
+		decoder *NetASCIIDecoder
+	)
+
+	if isNetASCII(wrq.Mode) {
+		decoder = NewNetASCIIDecoder(payload)
+		payload = decoder
+	}
+
+	// Close the sink before acknowledging the final data packet so the client
+	// learns of any error flushing the file.
+	closed := false
+	finish := func() error {
+		closed = true
+
+		if decoder != nil {
+			err := decoder.Flush()
 			if err != nil {
-				log.Printf("[%s] write: %v", clientAddr, err)
-				return
+				_ = w.Close()
+				return err
 			}
+		}
 
-			// wait for the client's ACK packet
-			_ = conn.SetReadDeadline(time.Now().Add(s.Timeout))
+		return w.Close()
+	}
 
-			_, err = conn.Read(buf)
-			if err != nil {
-				if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
-					continue RETRY
-				}
+	defer func() {
+		if !closed {
+			_ = w.Close()
+		}
+	}()
 
-				log.Printf("[%s] waiting for ACK: %v", clientAddr, err)
-				return
-			}
+	blocks, err := t.receive(ctx, conn, payload, initial, finish)
+	if err != nil {
+		log.Printf("[%s] %v", clientAddr, err)
+		abandon(ctx, conn)
+		return nil, err
+	}
 
-			switch {
-			case ackPkt.UnmarshalBinary(buf) == nil:
-				if uint16(ackPkt) == dataPkt.Block {
-					// received ACK; send next data packet
-					continue NEXTPACKET
-				}
-			case errPkt.UnmarshalBinary(buf) == nil:
-				log.Printf("[%s] received error: %v",
-					clientAddr, errPkt.Message)
-				return
-			default:
-				log.Printf("[%s] bad packet", clientAddr)
-			}
+	log.Printf("[%s] received %d blocks", clientAddr, blocks)
+
+	// Hold a place among the transfers in progress, which the session gives
+	// up when handleWrite returns, so Shutdown waits for the dally.
+	s.transfers.Add(1)
+	dallying = true
+
+	return func() {
+		defer s.transfers.Done()
+
+		t.dally(ctx, conn)
+		_ = conn.Close()
+	}, nil
+}
+
+// abandon tells the client the server is abandoning the transfer if ctx is
+// done.
+func abandon(ctx context.Context, conn net.Conn) {
+	if ctx.Err() != nil {
+		_ = writeErr(conn, ErrUnknown, "server shutting down")
+	}
+}
+
+// Shutdown gracefully shuts down the server. It closes all listeners so the
+// server stops accepting requests, and then waits for transfers in progress
+// to finish. If ctx is done first, Shutdown cancels the remaining transfers
+// and returns ctx's error once they've stopped.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.inShutdown = true
+
+	for conn := range s.listeners {
+		_ = conn.Close()
+	}
+
+	abort := s.abort
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		s.transfers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		if abort != nil {
+			abort()
 		}
 
-		log.Printf("[%s] exhausted retries", clientAddr)
-		return
+		<-done
+
+		return ctx.Err()
 	}
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inShutdown
+}
+
+// trackListener registers conn so Shutdown can close it. It returns a
+// context Shutdown cancels if it gives up waiting for transfers.
+func (s *Server) trackListener(conn net.PacketConn) (context.Context, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inShutdown {
+		return nil, ErrServerClosed
+	}
+
+	if s.listeners == nil {
+		s.listeners = make(map[net.PacketConn]struct{})
+		s.abortCtx, s.abort = context.WithCancel(context.Background())
+	}
+
+	s.listeners[conn] = struct{}{}
+
+	return s.abortCtx, nil
+}
 
-	log.Printf("[%s] sent %d blocks", clientAddr, dataPkt.Block)
+func (s *Server) untrackListener(conn net.PacketConn) {
+	s.mu.Lock()
+	delete(s.listeners, conn)
+	s.mu.Unlock()
 }
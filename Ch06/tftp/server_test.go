@@ -2,10 +2,20 @@ package tftp
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"io"
+	"io/fs"
 	"net"
 	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -101,3 +111,894 @@ func TestServer(t *testing.T) {
 		t.Fatal("sent payload not equal to received payload")
 	}
 }
+
+// memSink is an in-memory Sink for testing write requests.
+type memSink struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (m *memSink) Create(filename string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[filename]; ok {
+		return nil, fs.ErrExist
+	}
+
+	return &memFile{sink: m, name: filename}, nil
+}
+
+func (m *memSink) file(filename string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.files[filename]
+
+	return b, ok
+}
+
+type memFile struct {
+	bytes.Buffer
+	sink *memSink
+	name string
+}
+
+func (f *memFile) Close() error {
+	f.sink.mu.Lock()
+	f.sink.files[f.name] = f.Bytes()
+	f.sink.mu.Unlock()
+
+	return nil
+}
+
+func TestServerWrite(t *testing.T) {
+	t.Parallel()
+
+	p1, err := os.ReadFile("./tftp/payload.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &memSink{files: map[string][]byte{"exists": nil}}
+	s := Server{Sink: sink}
+
+	done := make(chan struct{})
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendWRQ := func(filename string) {
+		b, err := WriteReq{Filename: filename}.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.WriteTo(b, conn.LocalAddr())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, DatagramSize)
+
+	// An existing file results in an ErrFileExists error packet.
+	sendWRQ("exists")
+
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+	n, _, err := client.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errPkt Err
+
+	err = errPkt.UnmarshalBinary(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errPkt.Error != ErrFileExists {
+		t.Fatalf("expected error code %d; actual %d", ErrFileExists, errPkt.Error)
+	}
+
+	sendWRQ("upload")
+
+	var (
+		data = Data{Payload: bytes.NewReader(p1)}
+		sent = DatagramSize
+	)
+
+	for {
+		_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+		n, addr, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ack Ack
+
+		err = ack.UnmarshalBinary(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if uint16(ack) != data.Block {
+			t.Fatalf("expected ACK %d; actual %d", data.Block, ack)
+		}
+
+		if sent < DatagramSize {
+			break // the server acknowledged the final data packet
+		}
+
+		b, err := data.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sent = len(b)
+
+		_, err = client.WriteTo(b, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_ = client.Close()
+	_ = conn.Close()
+
+	<-done
+
+	p2, ok := sink.file("upload")
+	if !ok {
+		t.Fatal("expected the sink to contain the uploaded file")
+	}
+
+	if !bytes.Equal(p1, p2) {
+		t.Fatal("sent payload not equal to received payload")
+	}
+}
+
+func TestServerWriteDally(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &memSink{files: make(map[string][]byte)}
+	s := Server{Sink: sink, Timeout: time.Second}
+	done := make(chan struct{})
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	defer func() {
+		_ = conn.Close()
+		<-done
+	}()
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	b, err := WriteReq{Filename: "upload"}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WriteTo(b, conn.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, DatagramSize)
+
+	readAck := func(expected uint16) net.Addr {
+		t.Helper()
+
+		_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+		n, addr, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ack Ack
+
+		err = ack.UnmarshalBinary(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if uint16(ack) != expected {
+			t.Fatalf("expected ACK %d; actual %d", expected, ack)
+		}
+
+		return addr
+	}
+
+	addr := readAck(0)
+
+	b, err = (&Data{Payload: strings.NewReader("short")}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Send the final data packet twice, as if the first acknowledgement were
+	// lost. The server acknowledges the retransmission too.
+	for i := 0; i < 2; i++ {
+		_, err = client.WriteTo(b, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		readAck(1)
+	}
+
+	p, ok := sink.file("upload")
+	if !ok || string(p) != "short" {
+		t.Errorf("expected the sink to contain %q; actual %q", "short", p)
+	}
+}
+
+func TestServerWriteDallyShutdown(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{Sink: &memSink{files: make(map[string][]byte)}, Timeout: time.Minute}
+	served := make(chan error)
+
+	go func() { served <- s.Serve(conn) }()
+
+	c := Client{Timeout: time.Second}
+
+	_, err = c.Put(context.Background(), conn.LocalAddr().String(), "upload",
+		strings.NewReader("short"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server is still dallying after the upload, so Shutdown waits for
+	// it, and then cancels it once its context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	err = s.Shutdown(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context deadline exceeded; actual %v", err)
+	}
+
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected Shutdown to cancel the dally; took %s", d)
+	}
+
+	if err = <-served; err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed; actual %v", err)
+	}
+}
+
+// fullWriter accepts limit bytes and then fails as if the disk were full.
+type fullWriter struct {
+	limit int
+}
+
+func (w *fullWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+
+		return n, &fs.PathError{Op: "write", Path: "full", Err: syscall.ENOSPC}
+	}
+
+	w.limit -= len(p)
+
+	return len(p), nil
+}
+
+func (w *fullWriter) Close() error { return nil }
+
+func TestServerWriteDiskFull(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{Sink: SinkFunc(func(string) (io.WriteCloser, error) {
+		return &fullWriter{limit: 2 * BlockSize}, nil
+	})}
+
+	done := make(chan struct{})
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	defer func() {
+		_ = conn.Close()
+		<-done
+	}()
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	b, err := WriteReq{Filename: "upload"}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WriteTo(b, conn.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		buf  = make([]byte, DatagramSize)
+		data = Data{Payload: bytes.NewReader(make([]byte, 5*BlockSize))}
+	)
+
+	// The server acknowledges the first two blocks, which fit, and replies to
+	// the third with an error packet.
+	for {
+		_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+		n, addr, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			ack    Ack
+			errPkt Err
+		)
+
+		if errPkt.UnmarshalBinary(buf[:n]) == nil {
+			if errPkt.Error != ErrDiskFull {
+				t.Fatalf("expected error code %d; actual %d", ErrDiskFull,
+					errPkt.Error)
+			}
+
+			if data.Block != 3 {
+				t.Fatalf("expected the error after block 3; actual block %d",
+					data.Block)
+			}
+
+			return
+		}
+
+		err = ack.UnmarshalBinary(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if uint16(ack) != data.Block {
+			t.Fatalf("expected ACK %d; actual %d", data.Block, ack)
+		}
+
+		if data.Block == 3 {
+			t.Fatal("expected an error packet instead of ACK 3")
+		}
+
+		b, err := data.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.WriteTo(b, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// download sends the read request to the server at addr and returns the
+// file's contents along with the server's option acknowledgement, if any. If
+// the server replies with an error packet, download returns it.
+func download(t *testing.T, addr net.Addr, rrq ReadReq) ([]byte, OAck, *Err) {
+	t.Helper()
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	b, err := rrq.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WriteTo(b, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		oack      OAck
+		blockSize = BlockSize
+		p         = new(bytes.Buffer)
+		buf       = make([]byte, 4+MaxBlockSize)
+	)
+
+	for {
+		_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+		n, addr, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			errPkt Err
+			data   Data
+			ack    Ack
+		)
+
+		switch {
+		case errPkt.UnmarshalBinary(buf[:n]) == nil:
+			return nil, oack, &errPkt
+		case oack == nil && oack.UnmarshalBinary(buf[:n]) == nil:
+			if v, ok := oack[OptBlockSize]; ok {
+				blockSize, err = strconv.Atoi(v)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		case data.UnmarshalBinary(buf[:n]) == nil:
+			_, err = io.Copy(p, data.Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ack = Ack(data.Block)
+		default:
+			t.Fatalf("unexpected packet: %v", buf[:n])
+		}
+
+		b, err = ack.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.WriteTo(b, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ack > 0 && n < 4+blockSize {
+			return p.Bytes(), oack, nil
+		}
+	}
+}
+
+func TestServerRoot(t *testing.T) {
+	t.Parallel()
+
+	root := fstest.MapFS{
+		"hello.txt":          {Data: []byte("Hello, world!")},
+		"firmware/image.bin": {Data: bytes.Repeat([]byte{0xAB}, 3*BlockSize)},
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	s := Server{Root: root}
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	for _, filename := range []string{
+		"hello.txt", "/hello.txt", "firmware/image.bin", "/firmware/./image.bin",
+	} {
+		p, _, errPkt := download(t, conn.LocalAddr(), ReadReq{Filename: filename})
+		if errPkt != nil {
+			t.Errorf("%s: unexpected error: %s", filename, errPkt.Message)
+			continue
+		}
+
+		expected := root[strings.TrimPrefix(path.Clean(filename), "/")].Data
+		if !bytes.Equal(expected, p) {
+			t.Errorf("%s: sent payload not equal to received payload", filename)
+		}
+	}
+
+	for _, tc := range []struct {
+		filename string
+		code     ErrCode
+	}{
+		{"missing.txt", ErrNotFound},
+		{"../hello.txt", ErrAccessViolation},
+		{"/../../etc/passwd", ErrAccessViolation},
+		{"firmware/../../hello.txt", ErrAccessViolation},
+		{"firmware", ErrAccessViolation},
+	} {
+		_, _, errPkt := download(t, conn.LocalAddr(), ReadReq{Filename: tc.filename})
+		if errPkt == nil {
+			t.Errorf("%s: expected error code %d", tc.filename, tc.code)
+			continue
+		}
+
+		if errPkt.Error != tc.code {
+			t.Errorf("%s: expected error code %d; actual %d",
+				tc.filename, tc.code, errPkt.Error)
+		}
+	}
+
+	_ = conn.Close()
+
+	<-done
+}
+
+func TestServerOptions(t *testing.T) {
+	t.Parallel()
+
+	p1 := make([]byte, 10000)
+
+	_, err := rand.Read(p1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	s := Server{Payload: p1}
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	for _, tc := range []struct {
+		options map[string]string
+		oack    OAck
+	}{
+		{ // no options
+			options: nil,
+			oack:    nil,
+		},
+		{ // every supported option
+			options: map[string]string{
+				OptBlockSize: "1428", OptTimeout: "2", OptTransferSize: "0",
+			},
+			oack: OAck{OptBlockSize: "1428", OptTimeout: "2", OptTransferSize: "10000"},
+		},
+		{ // block size larger than the maximum is lowered
+			options: map[string]string{OptBlockSize: "100000"},
+			oack:    OAck{OptBlockSize: strconv.Itoa(MaxBlockSize)},
+		},
+		{ // the payload is a multiple of the block size
+			options: map[string]string{OptBlockSize: "1000"},
+			oack:    OAck{OptBlockSize: "1000"},
+		},
+		{ // invalid and unknown options are ignored
+			options: map[string]string{OptBlockSize: "4", OptTimeout: "0", "color": "blue"},
+			oack:    nil,
+		},
+	} {
+		p2, oack, errPkt := download(t, conn.LocalAddr(),
+			ReadReq{Filename: "test", Options: tc.options})
+		if errPkt != nil {
+			t.Errorf("%v: unexpected error: %s", tc.options, errPkt.Message)
+			continue
+		}
+
+		if !reflect.DeepEqual(tc.oack, oack) {
+			t.Errorf("%v: expected OACK %v; actual %v", tc.options, tc.oack, oack)
+		}
+
+		if !bytes.Equal(p1, p2) {
+			t.Errorf("%v: sent payload not equal to received payload", tc.options)
+		}
+	}
+
+	_ = conn.Close()
+
+	<-done
+}
+
+func TestServerWindowSize(t *testing.T) {
+	t.Parallel()
+
+	const windowSize = 4
+
+	p1 := make([]byte, 10*BlockSize+100)
+
+	_, err := rand.Read(p1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	s := Server{Payload: p1, Timeout: 100 * time.Millisecond}
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ReadReq{
+		Filename: "test",
+		Options:  map[string]string{OptWindowSize: strconv.Itoa(windowSize)},
+	}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WriteTo(b, conn.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		p2       = new(bytes.Buffer)
+		buf      = make([]byte, DatagramSize)
+		ack      Ack  // the last in-order block received
+		received int  // in-order blocks received since the last ACK
+		gap      bool // true once we've acknowledged a gap
+		dropped  bool // true once we've simulated losing block 6
+		acks     int  // the number of ACKs sent
+	)
+
+	sendAck := func(addr net.Addr) {
+		b, err := ack.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.WriteTo(b, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		received = 0
+		acks++
+	}
+
+	for {
+		_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+		n, addr, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var oack OAck
+
+		if oack.UnmarshalBinary(buf[:n]) == nil {
+			if oack[OptWindowSize] != strconv.Itoa(windowSize) {
+				t.Fatalf("expected window size %d; actual %q",
+					windowSize, oack[OptWindowSize])
+			}
+
+			sendAck(addr)
+			continue
+		}
+
+		var data Data
+
+		err = data.UnmarshalBinary(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data.Block == 6 && !dropped {
+			dropped = true
+			continue
+		}
+
+		if data.Block != uint16(ack)+1 {
+			// Out of order. Acknowledge the last in-order block once, and
+			// wait for the server to resend from there.
+			if !gap {
+				gap = true
+				sendAck(addr)
+			}
+			continue
+		}
+
+		gap = false
+
+		_, err = io.Copy(p2, data.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ack = Ack(data.Block)
+		received++
+
+		if received == windowSize || n < DatagramSize {
+			sendAck(addr)
+		}
+
+		if n < DatagramSize {
+			break
+		}
+	}
+
+	_ = client.Close()
+	_ = conn.Close()
+
+	<-done
+
+	if !bytes.Equal(p1, p2.Bytes()) {
+		t.Fatal("sent payload not equal to received payload")
+	}
+
+	// 11 blocks in windows of 4 take 3 ACKs plus one for the OACK and one for
+	// the gap
+	if acks > 6 {
+		t.Errorf("expected no more than 6 ACKs; actual %d", acks)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{Payload: make([]byte, 10*BlockSize), Timeout: 5 * time.Second}
+	served := make(chan error)
+
+	go func() { served <- s.Serve(conn) }()
+
+	// A download that completes in time doesn't hold up Shutdown.
+	_, _, errPkt := download(t, conn.LocalAddr(), ReadReq{Filename: "test"})
+	if errPkt != nil {
+		t.Fatal(errPkt.Message)
+	}
+
+	// This client never acknowledges the first data packet, so its transfer
+	// outlasts Shutdown's deadline.
+	client, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	b, err := ReadReq{Filename: "test"}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WriteTo(b, conn.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, DatagramSize)
+
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+	_, _, err = client.ReadFrom(buf) // the first data packet
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	err = s.Shutdown(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context deadline exceeded; actual %v", err)
+	}
+
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected Shutdown to cancel the transfer; took %s", d)
+	}
+
+	if err = <-served; err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed; actual %v", err)
+	}
+
+	if sessions := s.Sessions(); len(sessions) > 0 {
+		t.Errorf("expected no sessions; actual %d", len(sessions))
+	}
+
+	// The server tells the client it abandoned the transfer.
+	n, _, err := client.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e Err
+
+	err = e.UnmarshalBinary(buf[:n])
+	if err != nil {
+		t.Fatalf("expected an error packet: %v", err)
+	}
+
+	if err = s.Serve(conn); err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed; actual %v", err)
+	}
+}
+
+func TestServerServeContext(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := Server{Payload: []byte("payload")}
+	served := make(chan error)
+
+	go func() { served <- s.ServeContext(ctx, conn) }()
+
+	p, _, errPkt := download(t, conn.LocalAddr(), ReadReq{Filename: "test"})
+	if errPkt != nil {
+		t.Fatal(errPkt.Message)
+	}
+
+	if string(p) != "payload" {
+		t.Errorf("expected %q; actual %q", "payload", p)
+	}
+
+	cancel()
+
+	select {
+	case err = <-served:
+		if err != context.Canceled {
+			t.Errorf("expected context canceled; actual %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected ServeContext to return")
+	}
+}
@@ -0,0 +1,114 @@
+package tftp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Session describes a transfer in progress.
+type Session struct {
+	ClientAddr string    // the client's address
+	Filename   string    // the requested file
+	Op         OpCode    // OpRRQ for downloads, or OpWRQ for uploads
+	Blocks     int64     // data packets transferred so far
+	Bytes      int64     // bytes read from the file or written to the sink so far
+	Start      time.Time // when the server received the request
+}
+
+// session tracks a transfer in progress.
+type session struct {
+	Session
+	ip     string
+	blocks atomic.Int64
+	bytes  int64 // updated atomically
+}
+
+// setBlocks records the number of data packets transferred so far.
+func (ss *session) setBlocks(n int) { ss.blocks.Store(int64(n)) }
+
+// snapshot returns the session's current state.
+func (ss *session) snapshot() Session {
+	snapshot := ss.Session
+	snapshot.Blocks = ss.blocks.Load()
+	snapshot.Bytes = atomic.LoadInt64(&ss.bytes)
+
+	return snapshot
+}
+
+// Sessions returns the server's transfers in progress, oldest first.
+func (s *Server) Sessions() []Session {
+	s.mu.Lock()
+	sessions := make([]Session, 0, len(s.sessions))
+	for ss := range s.sessions {
+		sessions = append(sessions, ss.snapshot())
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(sessions, func(a, b Session) int { return a.Start.Compare(b.Start) })
+
+	return sessions
+}
+
+// startSession starts tracking a transfer for the client at addr. It returns
+// an error if the transfer would exceed the server's concurrency limits.
+func (s *Server) startSession(addr net.Addr, filename string, op OpCode) (*session, error) {
+	ip, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		ip = addr.String()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inShutdown {
+		return nil, ErrServerClosed
+	}
+
+	if s.MaxTransfers > 0 && len(s.sessions) >= s.MaxTransfers {
+		return nil, errors.New("too many transfers")
+	}
+
+	if s.MaxTransfersPerIP > 0 && s.transfersPerIP[ip] >= s.MaxTransfersPerIP {
+		return nil, fmt.Errorf("too many transfers from %s", ip)
+	}
+
+	if s.sessions == nil {
+		s.sessions = make(map[*session]struct{})
+		s.transfersPerIP = make(map[string]int)
+	}
+
+	ss := &session{
+		Session: Session{
+			ClientAddr: addr.String(),
+			Filename:   filename,
+			Op:         op,
+			Start:      time.Now(),
+		},
+		ip: ip,
+	}
+
+	s.sessions[ss] = struct{}{}
+	s.transfersPerIP[ip]++
+	s.transfers.Add(1)
+
+	return ss, nil
+}
+
+// endSession stops tracking the transfer.
+func (s *Server) endSession(ss *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, ss)
+
+	s.transfersPerIP[ss.ip]--
+	if s.transfersPerIP[ss.ip] == 0 {
+		delete(s.transfersPerIP, ss.ip)
+	}
+
+	s.transfers.Done()
+}
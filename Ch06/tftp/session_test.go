@@ -0,0 +1,138 @@
+package tftp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerLimits(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{
+		Payload:           make([]byte, 10*BlockSize),
+		Retries:           1,
+		Timeout:           500 * time.Millisecond,
+		MaxTransfersPerIP: 1,
+	}
+	done := make(chan struct{})
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	// request sends a read request from a new client and returns the
+	// client along with the first packet the server sends it.
+	request := func(filename string) (net.PacketConn, []byte, net.Addr) {
+		client, err := net.ListenPacket("udp", "127.0.0.1:")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ReadReq{Filename: filename}.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.WriteTo(b, conn.LocalAddr())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+		buf := make([]byte, DatagramSize)
+
+		n, addr, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return client, buf[:n], addr
+	}
+
+	// The first client acknowledges the first data packet and then stops
+	// responding, keeping its transfer in progress.
+	c1, pkt, addr := request("first")
+	defer func() { _ = c1.Close() }()
+
+	var data Data
+
+	err = data.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Ack(data.Block).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c1.WriteTo(b, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the server to count the acknowledged block.
+	var sessions []Session
+
+	for i := 0; ; i++ {
+		sessions = s.Sessions()
+		if len(sessions) == 1 && sessions[0].Blocks == 1 {
+			break
+		}
+
+		if i == 50 {
+			t.Fatalf("expected 1 session with 1 block; actual %+v", sessions)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if ss := sessions[0]; ss.ClientAddr != c1.LocalAddr().String() ||
+		ss.Filename != "first" || ss.Op != OpRRQ || ss.Blocks != 1 {
+		t.Errorf("unexpected session: %+v", ss)
+	}
+
+	// A second client from the same IP exceeds the limit.
+	c2, pkt, _ := request("second")
+	_ = c2.Close()
+
+	var errPkt Err
+
+	err = errPkt.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatalf("expected an error packet: %v", err)
+	}
+
+	if errPkt.Error != ErrUnknown {
+		t.Errorf("expected error code %d; actual %d", ErrUnknown, errPkt.Error)
+	}
+
+	// The first transfer ends once the server exhausts its retries.
+	for i := 0; len(s.Sessions()) > 0; i++ {
+		if i == 50 {
+			t.Fatal("expected the session to end")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	c3, pkt, _ := request("third")
+	_ = c3.Close()
+
+	err = data.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatalf("expected a data packet: %v", err)
+	}
+
+	_ = conn.Close()
+
+	<-done
+}
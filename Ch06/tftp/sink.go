@@ -0,0 +1,86 @@
+package tftp
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Sink receives the files clients upload with write requests.
+//
+// Create returns a writer for the named file. If the file already exists,
+// Create should return an error satisfying errors.Is(err, fs.ErrExist) so the
+// server can reply with ErrFileExists. Writers that run out of space should
+// return an error satisfying errors.Is(err, syscall.ENOSPC) so the server can
+// reply with ErrDiskFull.
+type Sink interface {
+	Create(filename string) (io.WriteCloser, error)
+}
+
+// SinkFunc adapts an ordinary function to the Sink interface.
+type SinkFunc func(filename string) (io.WriteCloser, error)
+
+func (f SinkFunc) Create(filename string) (io.WriteCloser, error) {
+	return f(filename)
+}
+
+// DirSink is a Sink that creates uploaded files in the directory it names,
+// resolving filenames as the server does for its Root. It never overwrites an
+// existing file, and it leaves behind whatever part of a failed upload it
+// received.
+type DirSink string
+
+func (d DirSink) Create(filename string) (io.WriteCloser, error) {
+	name, err := resolve(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// O_EXCL makes an existing file an fs.ErrExist error.
+	return os.OpenFile(filepath.Join(string(d), filepath.FromSlash(name)),
+		os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+}
+
+// errCode maps err to the TFTP error code that best describes it.
+func errCode(err error) ErrCode {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return ErrAccessViolation
+	case errors.Is(err, fs.ErrExist):
+		return ErrFileExists
+	case errors.Is(err, syscall.ENOSPC):
+		return ErrDiskFull
+	}
+
+	return ErrUnknown
+}
+
+// writeErr sends an error packet with the given code and message to w.
+func writeErr(w io.Writer, code ErrCode, message string) error {
+	b, err := Err{Error: code, Message: message}.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
+
+// writeErrTo sends an error packet with the given code and message to addr.
+func writeErrTo(conn net.PacketConn, addr net.Addr, code ErrCode, message string) error {
+	b, err := Err{Error: code, Message: message}.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.WriteTo(b, addr)
+
+	return err
+}
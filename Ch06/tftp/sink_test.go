@@ -0,0 +1,74 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirSink(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{Sink: DirSink(dir)}
+	done := make(chan struct{})
+
+	go func() {
+		_ = s.Serve(conn)
+		close(done)
+	}()
+
+	defer func() {
+		_ = conn.Close()
+		<-done
+	}()
+
+	var (
+		c       Client
+		addr    = conn.LocalAddr().String()
+		payload = bytes.Repeat([]byte("uploaded "), 200)
+	)
+
+	_, err = c.Put(context.Background(), addr, "/upload.txt", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "upload.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, payload) {
+		t.Error("uploaded file not equal to sent payload")
+	}
+
+	// The sink doesn't overwrite files or write outside its directory.
+	for filename, code := range map[string]ErrCode{
+		"upload.txt":    ErrFileExists,
+		"../escape.txt": ErrAccessViolation,
+	} {
+		_, err = c.Put(context.Background(), addr, filename, bytes.NewReader(payload))
+
+		var rErr *RemoteError
+		if !errors.As(err, &rErr) || rErr.Code != code {
+			t.Errorf("%s: expected error code %d; actual %v", filename, code, err)
+		}
+	}
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(dir), "escape.txt"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected no file outside the sink's directory; actual %v", err)
+	}
+}
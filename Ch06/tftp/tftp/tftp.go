@@ -3,26 +3,139 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
 
 	tftp "github.com/nicholas-fedor/Network-Programming-with-Go/Ch06/tftp"
 )
 
 var (
-	address = flag.String("a", "127.0.0.1:69", "listen address")
-	payload = flag.String("p", "payload.svg", "file to serve to clients")
+	address    = flag.String("a", "127.0.0.1:69", "listen address, or the server address for get and put")
+	payload    = flag.String("p", "payload.svg", "file to serve to clients")
+	root       = flag.String("root", "", "directory to serve files from by name; overrides -p")
+	upload     = flag.String("upload", "", "directory to store files clients put; enables write requests")
+	mode       = flag.String("mode", "octet", "transfer mode for get and put: octet or netascii")
+	blockSize  = flag.Int("blksize", 0, "block size to request for get and put")
+	windowSize = flag.Int("windowsize", 0, "window size to request for get and put")
+	rollover   = flag.Uint("rollover", 0, "block number following 65535: 0 or 1")
 )
 
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage:\n"+
+			"  %[1]s [options]                            serve files\n"+
+			"  %[1]s [options] get remote-file [local-file]  download a file\n"+
+			"  %[1]s [options] put local-file [remote-file]  upload a file\n"+
+			"Options:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
 func main() {
 	flag.Parse()
 
-	p, err := os.ReadFile(*payload)
-	if err != nil {
-		log.Fatal(err)
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+	case "get", "put":
+		err := transfer(cmd, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	default:
+		fmt.Printf("unknown command %q\n\n", cmd)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	s := tftp.Server{Rollover: uint16(*rollover)}
+
+	if *upload != "" {
+		s.Sink = tftp.DirSink(*upload)
+	}
+
+	if *root != "" {
+		s.Root = os.DirFS(*root)
+	} else {
+		p, err := os.ReadFile(*payload)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s.Payload = p
 	}
 
-	s := tftp.Server{Payload: p}
 	log.Fatal(s.ListenAndServe(*address))
 }
+
+// transfer downloads a file from or uploads a file to the server at the
+// address given by the -a flag.
+func transfer(cmd string, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Printf("%s requires a file name\n\n", cmd)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := tftp.Client{
+		Mode:       *mode,
+		BlockSize:  *blockSize,
+		WindowSize: *windowSize,
+		Rollover:   uint16(*rollover),
+	}
+
+	if cmd == "get" {
+		remote, local := args[0], path.Base(args[0])
+		if len(args) == 2 {
+			local = args[1]
+		}
+
+		f, err := os.Create(local)
+		if err != nil {
+			return err
+		}
+
+		n, err := c.Get(ctx, *address, remote, f)
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+		if err != nil {
+			_ = os.Remove(local)
+			return err
+		}
+
+		log.Printf("received %s (%d bytes)", remote, n)
+
+		return nil
+	}
+
+	local, remote := args[0], filepath.Base(args[0])
+	if len(args) == 2 {
+		remote = args[1]
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	n, err := c.Put(ctx, *address, remote, f)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("sent %s (%d bytes)", remote, n)
+
+	return nil
+}
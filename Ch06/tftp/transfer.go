@@ -0,0 +1,374 @@
+package tftp
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"time"
+)
+
+// ErrRetriesExhausted is returned when the other end of a transfer stops
+// responding.
+var ErrRetriesExhausted = errors.New("exhausted retries")
+
+// RemoteError is an error packet received from the other end of a transfer.
+type RemoteError struct {
+	Code    ErrCode
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("received error %d: %s", e.Code, e.Message)
+}
+
+// packetConn is the part of a net.Conn a transfer needs to exchange packets
+// with the other end.
+type packetConn interface {
+	io.ReadWriter
+	SetReadDeadline(time.Time) error
+}
+
+// transfer holds the settings in effect for a single transfer.
+type transfer struct {
+	blockSize  int           // bytes of payload per data packet
+	timeout    time.Duration // time to wait before retransmitting
+	windowSize int           // data packets sent per acknowledgement
+	retries    uint8         // the number of times to retransmit
+	rollover   uint16        // the block number following 65535: 0 or 1
+
+	// progress, if not nil, receives the running count of data packets
+	// transferred.
+	progress func(blocks int)
+
+	// retransmit, if not nil, is called with the block number of each data
+	// packet sent again, or each acknowledgement sent again, after a timeout.
+	retransmit func(block uint16)
+}
+
+// datagramSize returns the size of a full data packet for the transfer.
+func (t transfer) datagramSize() int { return 4 + t.blockSize }
+
+// read reads the next packet from conn into buf, waiting no longer than the
+// transfer's timeout. If ctx is done, read returns the context's error.
+func (t transfer) read(ctx context.Context, conn packetConn, buf []byte) (int, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(t.timeout))
+
+	// Check the context after setting the deadline, since canceling the
+	// context may have set a deadline in the past that we just overwrote.
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return 0, ctxErr
+		}
+	}
+
+	return n, err
+}
+
+// isTimeout reports whether err is a read timeout. Context errors don't
+// count, even though context.DeadlineExceeded reports itself as a timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	nErr, ok := err.(net.Error)
+
+	return ok && nErr.Timeout()
+}
+
+// exchange sends pkt to the other end and returns the first packet it
+// receives in response, retransmitting pkt on timeout.
+func (t transfer) exchange(ctx context.Context, conn packetConn,
+	pkt encoding.BinaryMarshaler, buf []byte) (int, error) {
+	b, err := pkt.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := t.retries; i > 0; i-- {
+		_, err = conn.Write(b)
+		if err != nil {
+			return 0, fmt.Errorf("write: %w", err)
+		}
+
+		n, err := t.read(ctx, conn, buf)
+		if err != nil {
+			if isTimeout(err) {
+				continue
+			}
+
+			return 0, err
+		}
+
+		var errPkt Err
+
+		if errPkt.UnmarshalBinary(buf[:n]) == nil {
+			return 0, &RemoteError{Code: errPkt.Error, Message: errPkt.Message}
+		}
+
+		return n, nil
+	}
+
+	return 0, ErrRetriesExhausted
+}
+
+// send transmits the contents of r to the other end in data packets and waits
+// for it to acknowledge them. It returns the number of data packets the other
+// end acknowledged.
+//
+// send transmits a window of data packets before waiting for the other end
+// to acknowledge the last one (RFC 7440). If the other end acknowledges an
+// earlier block, the next window starts after that block. A window size of 1
+// makes the transfer lock-step.
+func (t transfer) send(ctx context.Context, conn packetConn, r io.Reader) (int, error) {
+	var (
+		ackPkt  Ack
+		errPkt  Err
+		dataPkt = Data{Payload: r, BlockSize: t.blockSize, Rollover: t.rollover}
+		buf     = make([]byte, DatagramSize)
+		window  [][]byte // data packets sent but not yet acknowledged
+		numbers []uint16 // the block number of each data packet in the window
+		last    bool     // true once the final data packet is in the window
+		blocks  int      // data packets acknowledged
+	)
+
+NEXTWINDOW:
+	for {
+		for len(window) < t.windowSize && !last {
+			data, err := dataPkt.MarshalBinary()
+			if err != nil {
+				return blocks, fmt.Errorf("preparing data packet: %w", err)
+			}
+
+			window = append(window, data)
+			numbers = append(numbers, dataPkt.Block)
+			last = len(data) < t.datagramSize()
+		}
+
+		if len(window) == 0 {
+			return blocks, nil // the other end acknowledged every data packet
+		}
+
+	RETRY:
+		for i := t.retries; i > 0; i-- {
+			for j, data := range window {
+				_, err := conn.Write(data) // send the data packet
+				if err != nil {
+					return blocks, fmt.Errorf("write: %w", err)
+				}
+
+				if i < t.retries && t.retransmit != nil {
+					t.retransmit(numbers[j])
+				}
+			}
+
+			for {
+				// wait for the ACK packet
+				n, err := t.read(ctx, conn, buf)
+				if err != nil {
+					if isTimeout(err) {
+						continue RETRY
+					}
+
+					return blocks, fmt.Errorf("waiting for ACK: %w", err)
+				}
+
+				switch {
+				case ackPkt.UnmarshalBinary(buf[:n]) == nil:
+					// the number of data packets in the window the ACK covers
+					acked := slices.Index(numbers, uint16(ackPkt)) + 1
+					if acked > 0 {
+						window, numbers = window[acked:], numbers[acked:]
+						blocks += acked
+
+						if t.progress != nil {
+							t.progress(blocks)
+						}
+
+						continue NEXTWINDOW
+					}
+					// ignore stale ACKs and keep waiting
+				case errPkt.UnmarshalBinary(buf[:n]) == nil:
+					return blocks, &RemoteError{Code: errPkt.Error, Message: errPkt.Message}
+				}
+			}
+		}
+
+		return blocks, ErrRetriesExhausted
+	}
+}
+
+// receive writes the payload of each data packet from the other end to w
+// until it receives a data packet shorter than a full block. It returns the
+// number of data packets it received.
+//
+// receive acknowledges the last data packet in each window, or the last
+// in-order data packet if it notices a gap. It sends initial, if not nil, in
+// place of ACK 0. Before acknowledging the final data packet, receive calls
+// finish, if not nil, so the other end learns if finishing the file failed.
+func (t transfer) receive(ctx context.Context, conn packetConn, w io.Writer,
+	initial encoding.BinaryMarshaler, finish func() error) (int, error) {
+	var (
+		ackPkt  Ack // block number of the last data packet written to w
+		errPkt  Err
+		dataPkt Data
+		buf     = make([]byte, t.datagramSize())
+		blocks  int // data packets written to w
+	)
+
+	// sendAck acknowledges the last data packet written to w.
+	sendAck := func() error {
+		var pkt encoding.BinaryMarshaler = ackPkt
+		if blocks == 0 {
+			if initial == nil {
+				return nil
+			}
+
+			pkt = initial
+		}
+
+		b, err := pkt.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.Write(b)
+		if err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+
+		return nil
+	}
+
+NEXTWINDOW:
+	for last := false; !last; {
+	RETRY:
+		for i := t.retries; i > 0; i-- {
+			err := sendAck()
+			if err != nil {
+				return blocks, err
+			}
+
+			if i < t.retries && t.retransmit != nil {
+				t.retransmit(uint16(ackPkt))
+			}
+
+			var (
+				received int  // data packets received in this window
+				gap      bool // true once we've acknowledged a gap in this window
+			)
+
+			for {
+				// wait for the next DATA packet
+				n, err := t.read(ctx, conn, buf)
+				if err != nil {
+					if isTimeout(err) {
+						if received > 0 {
+							continue NEXTWINDOW // acknowledge what we have
+						}
+
+						continue RETRY
+					}
+
+					return blocks, fmt.Errorf("waiting for DATA: %w", err)
+				}
+
+				switch {
+				case dataPkt.UnmarshalBinary(buf[:n]) == nil:
+					if dataPkt.Block != nextBlock(uint16(ackPkt), t.rollover) {
+						// Duplicate or out-of-order data packet. Acknowledge
+						// the last in-order packet once so the other end
+						// resends from there, and ignore the rest of the window.
+						if !gap {
+							gap = true
+
+							err = sendAck()
+							if err != nil {
+								return blocks, err
+							}
+						}
+
+						continue
+					}
+
+					_, err = io.Copy(w, dataPkt.Payload)
+					if err != nil {
+						_ = writeErr(conn, errCode(err), err.Error())
+						return blocks, err
+					}
+
+					ackPkt = Ack(dataPkt.Block)
+					blocks++
+					received++
+
+					if t.progress != nil {
+						t.progress(blocks)
+					}
+
+					gap = false
+					last = n < t.datagramSize()
+
+					if received == t.windowSize || last {
+						continue NEXTWINDOW
+					}
+				case errPkt.UnmarshalBinary(buf[:n]) == nil:
+					return blocks, &RemoteError{Code: errPkt.Error, Message: errPkt.Message}
+				}
+			}
+		}
+
+		return blocks, ErrRetriesExhausted
+	}
+
+	if finish != nil {
+		err := finish()
+		if err != nil {
+			_ = writeErr(conn, errCode(err), err.Error())
+			return blocks, err
+		}
+	}
+
+	return blocks, sendAck()
+}
+
+// dally acknowledges retransmissions of the final data packet for one timeout
+// after receive returns, in case the final acknowledgement was lost and the
+// other end is still waiting for it (RFC 1350, section 6). The final data
+// packet is the one shorter than a full block. dally returns early if ctx is
+// done.
+func (t transfer) dally(ctx context.Context, conn packetConn) {
+	var (
+		dataPkt Data
+		buf     = make([]byte, t.datagramSize())
+	)
+
+	_ = conn.SetReadDeadline(time.Now().Add(t.timeout))
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+
+		if n < len(buf) && dataPkt.UnmarshalBinary(buf[:n]) == nil {
+			b, err := Ack(dataPkt.Block).MarshalBinary()
+			if err != nil {
+				return
+			}
+
+			_, _ = conn.Write(b)
+		}
+	}
+}
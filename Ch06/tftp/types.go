@@ -17,27 +17,32 @@ const (
 	// The maximum block si ze is the datagram size minus a 4-byte header.
 	DatagramSize = 516              // the maximum supported datagram size
 	BlockSize    = DatagramSize - 4 // the DatagramSize minus a 4-byte header
+
+	// Clients may negotiate a different block size per transfer using the
+	// blksize option (RFC 2348), within these limits.
+	MinBlockSize = 8
+	MaxBlockSize = 65464
 )
 
 // The first two bytes of a TFTP packet's header is an operation code.
 // Each operation code is a 2-byte, unsigned integer.
 type OpCode uint16
 
-// Our server supports four operations:
-// A read request (RRQ), a data operation, an acknowledgement, and an error.
-// Since our server is read-only, we skip the write request (WRQ) definition.
+// Our server supports six operations:
+// A read request (RRQ), a write request (WRQ), a data operation, an
+// acknowledgement, an error, and an option acknowledgement (RFC 2347).
 const (
 	OpRRQ OpCode = iota + 1
-	_            // no WRQ support
+	OpWRQ
 	OpData
 	OpAck
 	OpErr
+	OpOAck
 )
 
 // We define a series of unsigned 16-bit integer error codes per the RFC.
-// Although we don't use all error codes in our server since it only allows
-// downloads, a client could return these error codes in lieu of an
-// acknowledgement packet.
+// The server returns these error codes when it cannot satisfy a request, and
+// a client could return them in lieu of an acknowledgement packet.
 type ErrCode uint16
 
 const (
@@ -49,6 +54,7 @@ const (
 	ErrUnknownID
 	ErrFileExists
 	ErrNoUser
+	ErrBadOption // option negotiation failed (RFC 2347)
 )
 
 // Pages 122-123
@@ -62,17 +68,19 @@ const (
 type ReadReq struct {
 	Filename string
 	Mode     string
+	Options  map[string]string // optional option names and values (RFC 2347)
 }
 
-// Although not used by our server, a client would make use of this method.
+// Although not used by our server, the Client uses this method to send its
+// read requests.
 func (q ReadReq) MarshalBinary() ([]byte, error) {
 	mode := "octet"
 	if q.Mode != "" {
 		mode = q.Mode
 	}
 
-	// operation code + filename + 0 byte + mode + 0 byte
-	cap := 2 + 2 + len(q.Filename) + 1 + len(q.Mode) + 1
+	// operation code + filename + 0 byte + mode + 0 byte + options
+	cap := 2 + len(q.Filename) + 1 + len(mode) + 1 + optionsLen(q.Options)
 
 	b := new(bytes.Buffer)
 	b.Grow(cap)
@@ -108,6 +116,11 @@ func (q ReadReq) MarshalBinary() ([]byte, error) {
 		return nil, err
 	}
 
+	err = writeOptions(b, q.Options) // write options
+	if err != nil {
+		return nil, err
+	}
+
 	return b.Bytes(), nil
 }
 
@@ -125,7 +138,7 @@ func (q *ReadReq) UnmarshalBinary(p []byte) error {
 	// operation code is that of a read request.
 	err := binary.Read(r, binary.BigEndian, &code) // read operation code
 	if err != nil {
-		return nil
+		return errors.New("invalid RRQ")
 	}
 
 	if code != OpRRQ {
@@ -154,9 +167,114 @@ func (q *ReadReq) UnmarshalBinary(p []byte) error {
 		return errors.New("invalid RRQ")
 	}
 
-	actual := strings.ToLower(q.Mode) // enforce octet mode
-	if actual != "octet" {
-		return errors.New("only binary transfers supported")
+	actual := strings.ToLower(q.Mode) // enforce octet or netascii mode
+	if actual != "octet" && actual != "netascii" {
+		return errors.New("only octet and netascii transfers supported")
+	}
+
+	q.Options, err = readOptions(r) // read options
+	if err != nil {
+		return errors.New("invalid options")
+	}
+
+	return nil
+}
+
+// WriteReq represents a write request, which a client sends to upload a file
+// to the server. It has the same layout as a read request.
+type WriteReq struct {
+	Filename string
+	Mode     string
+	Options  map[string]string // optional option names and values (RFC 2347)
+}
+
+func (q WriteReq) MarshalBinary() ([]byte, error) {
+	mode := "octet"
+	if q.Mode != "" {
+		mode = q.Mode
+	}
+
+	// operation code + filename + 0 byte + mode + 0 byte + options
+	cap := 2 + len(q.Filename) + 1 + len(mode) + 1 + optionsLen(q.Options)
+
+	b := new(bytes.Buffer)
+	b.Grow(cap)
+
+	err := binary.Write(b, binary.BigEndian, OpWRQ) // write operation code
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = b.WriteString(q.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.WriteByte(0) // write 0 byte
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = b.WriteString(mode) // write mode
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.WriteByte(0) // write 0 byte
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeOptions(b, q.Options) // write options
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func (q *WriteReq) UnmarshalBinary(p []byte) error {
+	r := bytes.NewBuffer(p)
+
+	var code OpCode
+
+	err := binary.Read(r, binary.BigEndian, &code) // read operation code
+	if err != nil {
+		return errors.New("invalid WRQ")
+	}
+
+	if code != OpWRQ {
+		return errors.New("invalid WRQ")
+	}
+
+	q.Filename, err = r.ReadString(0) // read filename
+	if err != nil {
+		return errors.New("invalid WRQ")
+	}
+
+	q.Filename = strings.TrimRight(q.Filename, "\x00") // remove the 0-byte
+	if len(q.Filename) == 0 {
+		return errors.New("invalid WRQ")
+	}
+
+	q.Mode, err = r.ReadString(0) // read mode
+	if err != nil {
+		return errors.New("invalid WRQ")
+	}
+
+	q.Mode = strings.TrimRight(q.Mode, "\x00") // remove the 0-byte
+	if len(q.Mode) == 0 {
+		return errors.New("invalid WRQ")
+	}
+
+	actual := strings.ToLower(q.Mode) // enforce octet or netascii mode
+	if actual != "octet" && actual != "netascii" {
+		return errors.New("only octet and netascii transfers supported")
+	}
+
+	q.Options, err = readOptions(r) // read options
+	if err != nil {
+		return errors.New("invalid options")
 	}
 
 	return nil
@@ -166,17 +284,37 @@ func (q *ReadReq) UnmarshalBinary(p []byte) error {
 // Listing 6-4: Date type and its binary marshaling method.
 // Data struct keeps track of the current block number and the data source.
 type Data struct {
-	Block   uint16
-	Payload io.Reader
+	Block     uint16
+	Payload   io.Reader
+	BlockSize int    // the negotiated block size; BlockSize if zero
+	Rollover  uint16 // the block number following 65535: 0 (the default) or 1
+}
+
+// nextBlock returns the block number following block. After 65535, block
+// numbers roll over to 0 if rollover is 0, or to 1 otherwise, so transfers may
+// exceed 65535 blocks.
+func nextBlock(block, rollover uint16) uint16 {
+	block++
+	if block == 0 && rollover != 0 {
+		block = 1
+	}
+
+	return block
 }
 
 // MarshalBinary will return 516 bytes per call at most by relying on the
-// io.CopyN function and the BlockSize constant.
+// io.CopyN function and the BlockSize constant, unless the transfer negotiated
+// a different block size.
 func (d *Data) MarshalBinary() ([]byte, error) {
+	size := d.BlockSize
+	if size == 0 {
+		size = BlockSize
+	}
+
 	b := new(bytes.Buffer)
-	b.Grow(DatagramSize)
+	b.Grow(4 + size)
 
-	d.Block++ // block numbers increment from 1
+	d.Block = nextBlock(d.Block, d.Rollover) // block numbers increment from 1
 
 	err := binary.Write(b, binary.BigEndian, OpData) // write operation code
 	if err != nil {
@@ -189,8 +327,8 @@ func (d *Data) MarshalBinary() ([]byte, error) {
 	}
 
 	// write up to BlockSize worth of bytes
-	_, err = io.CopyN(b, d.Payload, BlockSize)
-	if err != nil || err != io.EOF {
+	_, err = io.CopyN(b, d.Payload, int64(size))
+	if err != nil && err != io.EOF {
 		return nil, err
 	}
 
@@ -200,7 +338,7 @@ func (d *Data) MarshalBinary() ([]byte, error) {
 // Page 127
 // Listing 6-5: Data type implementation.
 func (d *Data) UnmarshalBinary(p []byte) error {
-	if l := len(p); l < 4 || l > DatagramSize {
+	if l := len(p); l < 4 || l > 4+MaxBlockSize {
 		return errors.New("invalid DATA")
 	}
 
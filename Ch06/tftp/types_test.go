@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"io"
+	"reflect"
 	"testing"
 )
 
@@ -193,3 +194,196 @@ func TestReadReq(t *testing.T) {
 		t.Errorf("expected mode %q; actual mode %q", r1.Mode, r2.Mode)
 	}
 }
+
+func TestWriteReq(t *testing.T) {
+	t.Parallel()
+
+	w1 := WriteReq{Filename: "firmware.bin", Mode: "octet"}
+
+	b, err := w1.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// operation code + filename + 0 byte + mode + 0 byte
+	expected := (2 + len(w1.Filename) + 1 + len(w1.Mode) + 1)
+	if len(b) != expected {
+		t.Fatalf("expected %d bytes; read %d bytes", expected, len(b))
+	}
+
+	if code := OpCode(binary.BigEndian.Uint16(b[:2])); code != OpWRQ {
+		t.Fatalf("expected operation code %d; actual %d", OpWRQ, code)
+	}
+
+	var w2 WriteReq
+
+	err = w2.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w1.Filename != w2.Filename {
+		t.Errorf("expected filename %q; actual filename %q", w1.Filename, w2.Filename)
+	}
+
+	if w1.Mode != w2.Mode {
+		t.Errorf("expected mode %q; actual mode %q", w1.Mode, w2.Mode)
+	}
+
+	var r ReadReq
+
+	if err = r.UnmarshalBinary(b); err == nil {
+		t.Error("expected a read request to reject a write request")
+	}
+}
+
+func TestReadReqOptions(t *testing.T) {
+	t.Parallel()
+
+	r1 := ReadReq{
+		Filename: "firmware.bin",
+		Mode:     "octet",
+		Options:  map[string]string{OptBlockSize: "1428", OptTransferSize: "0"},
+	}
+
+	b, err := r1.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "\x00\x01firmware.bin\x00octet\x00blksize\x001428\x00tsize\x000\x00"
+	if string(b) != expected {
+		t.Fatalf("expected %q; actual %q", expected, b)
+	}
+
+	// option names are case-insensitive
+	b = bytes.Replace(b, []byte("blksize"), []byte("BLKSIZE"), 1)
+
+	var r2 ReadReq
+
+	err = r2.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(r1, r2) {
+		t.Errorf("expected %#v; actual %#v", r1, r2)
+	}
+
+	// an option without a value is invalid
+	err = r2.UnmarshalBinary(append(b, "timeout\x00"...))
+	if err == nil {
+		t.Error("expected an error for an option without a value")
+	}
+}
+
+func TestOAck(t *testing.T) {
+	t.Parallel()
+
+	o1 := OAck{OptBlockSize: "1428", OptTimeout: "3"}
+
+	b, err := o1.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := OpCode(binary.BigEndian.Uint16(b[:2])); code != OpOAck {
+		t.Fatalf("expected operation code %d; actual %d", OpOAck, code)
+	}
+
+	var o2 OAck
+
+	err = o2.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(o1, o2) {
+		t.Errorf("expected %v; actual %v", o1, o2)
+	}
+}
+
+func TestDataMarshalBinaryBlockSize(t *testing.T) {
+	t.Parallel()
+
+	b1 := make([]byte, 2500)
+
+	_, err := rand.Read(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		d     = Data{Payload: bytes.NewReader(b1), BlockSize: 1024}
+		sizes []int
+	)
+
+	for {
+		p, err := d.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sizes = append(sizes, len(p)-4)
+
+		if len(p)-4 < d.BlockSize {
+			break
+		}
+	}
+
+	if expected := []int{1024, 1024, 452}; !reflect.DeepEqual(expected, sizes) {
+		t.Fatalf("expected block sizes %v; actual %v", expected, sizes)
+	}
+}
+
+func TestReadReqMode(t *testing.T) {
+	t.Parallel()
+
+	for mode, valid := range map[string]bool{
+		"octet":    true,
+		"OCTET":    true,
+		"netascii": true,
+		"NetASCII": true,
+		"mail":     false,
+	} {
+		b, err := ReadReq{Filename: "test", Mode: mode}.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var r ReadReq
+
+		err = r.UnmarshalBinary(b)
+		if valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", mode, err)
+		}
+
+		if !valid && err == nil {
+			t.Errorf("%s: expected an error", mode)
+		}
+	}
+}
+
+func TestDataMarshalBinaryRollover(t *testing.T) {
+	t.Parallel()
+
+	for _, rollover := range []uint16{0, 1} {
+		d := Data{Block: 65534, Payload: bytes.NewReader(make([]byte, 3*BlockSize)),
+			Rollover: rollover}
+
+		var blocks []uint16
+
+		for range 3 {
+			_, err := d.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			blocks = append(blocks, d.Block)
+		}
+
+		if expected := []uint16{65535, rollover, rollover + 1}; !reflect.DeepEqual(expected, blocks) {
+			t.Errorf("rollover %d: expected blocks %v; actual %v", rollover, expected, blocks)
+		}
+	}
+}